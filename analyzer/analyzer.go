@@ -0,0 +1,134 @@
+package analyzer
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Analyzer turns text of pages and queries into comparable tokens
+type Analyzer struct {
+	// Removes accents, so "café" and "cafe" are the same token
+	StripDiacritics bool
+	// Language used to remove stop words and stem tokens. Zero value keeps tokens as is
+	Language Language
+}
+
+func New() Analyzer {
+	return Analyzer{}
+}
+
+// Normalize applies NFKC normalization and case folding to text
+func (a Analyzer) Normalize(text string) string {
+	text = cases.Fold().String(norm.NFKC.String(text))
+	if a.StripDiacritics {
+		stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), text)
+		if err == nil {
+			text = stripped
+		}
+	}
+	return text
+}
+
+func isSeparator(char rune) bool {
+	return !unicode.IsLetter(char) && !unicode.IsDigit(char) && !unicode.IsMark(char)
+}
+
+// Tokenize normalizes text and splits it on word boundaries
+func (a Analyzer) Tokenize(text string) []string {
+	return strings.FieldsFunc(a.Normalize(text), isSeparator)
+}
+
+// Word is an analyzed token with its position in the original text
+type Word struct {
+	Token string
+	// Byte offsets of the word in the original text
+	Start, End int
+}
+
+// Words splits original text on word boundaries and analyzes every word, keeping
+// their offsets. Stop words are skipped like in Analyze.
+func (a Analyzer) Words(text string) []Word {
+	var words []Word
+	start := -1
+
+	addWord := func(end int) {
+		tokens := a.Analyze(text[start:end])
+		if len(tokens) > 0 {
+			words = append(words, Word{Token: strings.Join(tokens, " "), Start: start, End: end})
+		}
+		start = -1
+	}
+
+	for index, char := range text {
+		if isSeparator(char) {
+			if start != -1 {
+				addWord(index)
+			}
+		} else if start == -1 {
+			start = index
+		}
+	}
+	if start != -1 {
+		addWord(len(text))
+	}
+
+	return words
+}
+
+// WithLanguage returns a copy of the analyzer for the language. Unknown languages are
+// analyzed without stemming and stop words.
+func (a Analyzer) WithLanguage(code string) Analyzer {
+	a.Language, _ = LookupLanguage(code)
+	return a
+}
+
+// Analyze tokenizes text, removes stop words and stems tokens with the language of the analyzer
+func (a Analyzer) Analyze(text string) []string {
+	return a.AnalyzeTokens(a.Tokenize(text))
+}
+
+// AnalyzeTokens removes stop words and stems tokens which are already normalized
+func (a Analyzer) AnalyzeTokens(tokens []string) []string {
+	if a.Language.Stem == nil && a.Language.StopWords == nil {
+		return tokens
+	}
+
+	analyzed := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if a.Language.StopWords[token] {
+			continue
+		}
+		if a.Language.Stem != nil {
+			token = a.Language.Stem(token)
+		}
+		analyzed = append(analyzed, token)
+	}
+	return analyzed
+}
+
+// Contains reports whether tokens have all of the phrase tokens next to each other
+func Contains(tokens []string, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		matches := true
+		for j, token := range phrase {
+			if tokens[i+j] != token {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
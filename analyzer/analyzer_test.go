@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer Analyzer
+		text     string
+		want     []string
+	}{
+		{
+			name:     "case folding",
+			analyzer: New(),
+			text:     "SpaceX launches Falcon-9",
+			want:     []string{"spacex", "launches", "falcon", "9"},
+		},
+		{
+			name:     "compatibility characters",
+			analyzer: New(),
+			text:     "ﬁrst ＳＰＡＣＥＸ ①",
+			want:     []string{"first", "spacex", "1"},
+		},
+		{
+			name:     "german sharp s",
+			analyzer: New(),
+			text:     "STRASSE Straße",
+			want:     []string{"strasse", "strasse"},
+		},
+		{
+			name:     "cyrillic",
+			analyzer: New(),
+			text:     "Запуск РАКЕТЫ, «Союз»!",
+			want:     []string{"запуск", "ракеты", "союз"},
+		},
+		{
+			name:     "keeps diacritics by default",
+			analyzer: New(),
+			text:     "Café Ёлка",
+			want:     []string{"café", "ёлка"},
+		},
+		{
+			name:     "strips diacritics",
+			analyzer: Analyzer{StripDiacritics: true},
+			text:     "Café Ёлка naïve",
+			want:     []string{"cafe", "елка", "naive"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.analyzer.Tokenize(test.text)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		language string
+		text     string
+		want     []string
+	}{
+		{language: "en", text: "The next launches of the Falcon rockets", want: []string{"next", "launch", "falcon", "rocket"}},
+		{language: "ru", text: "Запуски ракет и кораблей", want: []string{"запуск", "ракет", "корабл"}},
+		{language: "de", text: "Die Raketen", want: []string{"die", "raketen"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.language, func(t *testing.T) {
+			got := New().WithLanguage(test.language).Analyze(test.text)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	text := "The Falcon-9 LAUNCHES, ракеты"
+	got := New().WithLanguage("en").Words(text)
+	want := []Word{
+		{Token: "falcon", Start: 4, End: 10},
+		{Token: "9", Start: 11, End: 12},
+		{Token: "launch", Start: 13, End: 21},
+		{Token: "ракеты", Start: 23, End: 35},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestContains(t *testing.T) {
+	tokens := []string{"the", "next", "launch", "window", "opens"}
+
+	tests := []struct {
+		phrase []string
+		want   bool
+	}{
+		{phrase: []string{"launch"}, want: true},
+		{phrase: []string{"launch", "window"}, want: true},
+		{phrase: []string{"window", "launch"}, want: false},
+		{phrase: []string{"opens", "today"}, want: false},
+		{phrase: []string{"lau"}, want: false},
+		{phrase: nil, want: false},
+	}
+
+	for _, test := range tests {
+		if got := Contains(tokens, test.phrase); got != test.want {
+			t.Errorf("Contains(%q) got %v, want %v", test.phrase, got, test.want)
+		}
+	}
+}
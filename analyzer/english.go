@@ -0,0 +1,326 @@
+package analyzer
+
+import "strings"
+
+var English = Language{
+	Code: "en",
+	Stem: stemEnglish,
+	StopWords: newStopWords(`a about above after again against all am an and any are as at be because been before
+		being below between both but by can did do does doing down during each few for from further had has have
+		having he her here hers herself him himself his how i if in into is it its itself just me more most my
+		myself no nor not now of off on once only or other our ours ourselves out over own same she should so some
+		such than that the their theirs them themselves then there these they this those through to too under
+		until up very was we were what when where which while who whom why will with you your yours yourself
+		yourselves`),
+}
+
+var englishExceptions = map[string]string{
+	"skis":   "ski",
+	"skies":  "sky",
+	"dying":  "die",
+	"lying":  "lie",
+	"tying":  "tie",
+	"idly":   "idl",
+	"gently": "gentl",
+	"ugly":   "ugli",
+	"early":  "earli",
+	"only":   "onli",
+	"singly": "singl",
+	"sky":    "sky",
+	"news":   "news",
+	"howe":   "howe",
+	"atlas":  "atlas",
+	"cosmos": "cosmos",
+	"bias":   "bias",
+	"andes":  "andes",
+}
+
+var englishInvariantsAfterStep1a = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+func isEnglishVowel(char byte) bool {
+	switch char {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+// englishWord is a word being stemmed with Porter2 algorithm. Letters "y" which are treated
+// as consonants are stored as "Y".
+type englishWord struct {
+	value  []byte
+	r1, r2 int
+}
+
+func (w *englishWord) hasSuffix(suffix string) bool {
+	return strings.HasSuffix(string(w.value), suffix)
+}
+
+func (w *englishWord) replace(suffixLength int, replacement string) {
+	w.value = append(w.value[:len(w.value)-suffixLength], replacement...)
+}
+
+func (w *englishWord) inR1(suffix string) bool {
+	return len(w.value)-len(suffix) >= w.r1
+}
+
+func (w *englishWord) inR2(suffix string) bool {
+	return len(w.value)-len(suffix) >= w.r2
+}
+
+// longestSuffix returns the longest of the suffixes the word ends with
+func (w *englishWord) longestSuffix(suffixes ...string) string {
+	var longest string
+	for _, suffix := range suffixes {
+		if len(suffix) > len(longest) && w.hasSuffix(suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+func (w *englishWord) isVowel(index int) bool {
+	return isEnglishVowel(w.value[index])
+}
+
+func (w *englishWord) hasVowelBefore(end int) bool {
+	for i := 0; i < end; i++ {
+		if w.isVowel(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithShortSyllable reports whether the word ends with a vowel followed by a non-vowel
+// other than "w", "x" or "Y" and preceded by a non-vowel, or is a vowel at the beginning
+// of the word followed by a non-vowel.
+func (w *englishWord) endsWithShortSyllable() bool {
+	length := len(w.value)
+	if length == 2 {
+		return w.isVowel(0) && !w.isVowel(1)
+	}
+	if length < 3 {
+		return false
+	}
+	last := w.value[length-1]
+	return !w.isVowel(length-3) && w.isVowel(length-2) && !w.isVowel(length-1) &&
+		last != 'w' && last != 'x' && last != 'Y'
+}
+
+func (w *englishWord) isShort() bool {
+	return w.r1 >= len(w.value) && w.endsWithShortSyllable()
+}
+
+// englishRegion returns the index after the first non-vowel following a vowel, both of them
+// being after start
+func englishRegion(value []byte, start int) int {
+	for i := start + 1; i < len(value); i++ {
+		if !isEnglishVowel(value[i]) && isEnglishVowel(value[i-1]) {
+			return i + 1
+		}
+	}
+	return len(value)
+}
+
+// stemEnglish implements Porter2 (Snowball English) stemming algorithm
+func stemEnglish(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 0x80 {
+			return word
+		}
+	}
+	if exception, ok := englishExceptions[word]; ok {
+		return exception
+	}
+
+	w := &englishWord{value: []byte(strings.TrimPrefix(word, "'"))}
+	if len(w.value) == 0 {
+		return word
+	}
+	for i := range w.value {
+		if w.value[i] == 'y' && (i == 0 || isEnglishVowel(w.value[i-1])) {
+			w.value[i] = 'Y'
+		}
+	}
+
+	w.r1 = len(w.value)
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(w.value), prefix) {
+			w.r1 = len(prefix)
+		}
+	}
+	if w.r1 == len(w.value) {
+		w.r1 = englishRegion(w.value, 0)
+	}
+	w.r2 = englishRegion(w.value, w.r1)
+
+	stemEnglishStep0(w)
+	stemEnglishStep1a(w)
+	if englishInvariantsAfterStep1a[string(w.value)] {
+		return string(w.value)
+	}
+	stemEnglishStep1b(w)
+	stemEnglishStep1c(w)
+	stemEnglishStep2(w)
+	stemEnglishStep3(w)
+	stemEnglishStep4(w)
+	stemEnglishStep5(w)
+
+	return strings.ReplaceAll(string(w.value), "Y", "y")
+}
+
+func stemEnglishStep0(w *englishWord) {
+	if suffix := w.longestSuffix("'", "'s", "'s'"); suffix != "" {
+		w.replace(len(suffix), "")
+	}
+}
+
+func stemEnglishStep1a(w *englishWord) {
+	switch suffix := w.longestSuffix("sses", "ied", "ies", "s", "us", "ss"); suffix {
+	case "sses":
+		w.replace(len(suffix), "ss")
+	case "ied", "ies":
+		if len(w.value) > 4 {
+			w.replace(len(suffix), "i")
+		} else {
+			w.replace(len(suffix), "ie")
+		}
+	case "s":
+		if len(w.value) > 2 && w.hasVowelBefore(len(w.value)-2) {
+			w.replace(1, "")
+		}
+	}
+}
+
+func stemEnglishStep1b(w *englishWord) {
+	switch suffix := w.longestSuffix("eed", "eedly", "ed", "edly", "ing", "ingly"); suffix {
+	case "eed", "eedly":
+		if w.inR1(suffix) {
+			w.replace(len(suffix), "ee")
+		}
+	case "ed", "edly", "ing", "ingly":
+		if !w.hasVowelBefore(len(w.value) - len(suffix)) {
+			return
+		}
+		w.replace(len(suffix), "")
+		switch {
+		case w.hasSuffix("at") || w.hasSuffix("bl") || w.hasSuffix("iz"):
+			w.replace(0, "e")
+		case w.longestSuffix("bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt") != "":
+			w.replace(1, "")
+		case w.isShort():
+			w.replace(0, "e")
+		}
+	}
+}
+
+func stemEnglishStep1c(w *englishWord) {
+	length := len(w.value)
+	if length > 2 && (w.value[length-1] == 'y' || w.value[length-1] == 'Y') && !w.isVowel(length-2) {
+		w.value[length-1] = 'i'
+	}
+}
+
+var englishStep2 = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able", "entli": "ent",
+	"izer": "ize", "ization": "ize", "ational": "ate", "ation": "ate", "ator": "ate",
+	"alism": "al", "aliti": "al", "alli": "al", "fulness": "ful", "ousli": "ous",
+	"ousness": "ous", "iveness": "ive", "iviti": "ive", "biliti": "ble", "bli": "ble",
+	"ogi": "og", "fulli": "ful", "lessli": "less", "li": "",
+}
+
+var englishStep2Suffixes = mapKeys(englishStep2)
+
+func stemEnglishStep2(w *englishWord) {
+	suffix := w.longestSuffix(englishStep2Suffixes...)
+	if suffix == "" || !w.inR1(suffix) {
+		return
+	}
+
+	preceding := byte(0)
+	if len(w.value) > len(suffix) {
+		preceding = w.value[len(w.value)-len(suffix)-1]
+	}
+	switch suffix {
+	case "ogi":
+		if preceding != 'l' {
+			return
+		}
+	case "li":
+		if !strings.ContainsRune("cdeghkmnrt", rune(preceding)) {
+			return
+		}
+	}
+	w.replace(len(suffix), englishStep2[suffix])
+}
+
+var englishStep3 = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic", "iciti": "ic",
+	"ical": "ic", "ful": "", "ness": "", "ative": "",
+}
+
+var englishStep3Suffixes = mapKeys(englishStep3)
+
+func stemEnglishStep3(w *englishWord) {
+	suffix := w.longestSuffix(englishStep3Suffixes...)
+	if suffix == "" || !w.inR1(suffix) {
+		return
+	}
+	if suffix == "ative" && !w.inR2(suffix) {
+		return
+	}
+	w.replace(len(suffix), englishStep3[suffix])
+}
+
+func stemEnglishStep4(w *englishWord) {
+	suffix := w.longestSuffix("al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement",
+		"ment", "ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion")
+	if suffix == "" || !w.inR2(suffix) {
+		return
+	}
+	if suffix == "ion" {
+		if len(w.value) < 4 {
+			return
+		}
+		preceding := w.value[len(w.value)-4]
+		if preceding != 's' && preceding != 't' {
+			return
+		}
+	}
+	w.replace(len(suffix), "")
+}
+
+func stemEnglishStep5(w *englishWord) {
+	switch {
+	case w.hasSuffix("e"):
+		if w.inR2("e") {
+			w.replace(1, "")
+			return
+		}
+		if w.inR1("e") {
+			w.replace(1, "")
+			if w.endsWithShortSyllable() {
+				w.replace(0, "e")
+			}
+		}
+	case w.hasSuffix("l"):
+		if w.inR2("l") && len(w.value) > 1 && w.value[len(w.value)-2] == 'l' {
+			w.replace(1, "")
+		}
+	}
+}
+
+func mapKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	return keys
+}
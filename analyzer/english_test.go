@@ -0,0 +1,45 @@
+package analyzer
+
+import "testing"
+
+func TestStemEnglish(t *testing.T) {
+	tests := map[string]string{
+		"launch":        "launch",
+		"launches":      "launch",
+		"launched":      "launch",
+		"launching":     "launch",
+		"rockets":       "rocket",
+		"vehicles":      "vehicl",
+		"consignment":   "consign",
+		"consistently":  "consist",
+		"conspicuously": "conspicu",
+		"generously":    "generous",
+		"running":       "run",
+		"hopping":       "hop",
+		"hoping":        "hope",
+		"happy":         "happi",
+		"caresses":      "caress",
+		"ponies":        "poni",
+		"ties":          "tie",
+		"gas":           "gas",
+		"agreed":        "agre",
+		"feed":          "feed",
+		"luxuriating":   "luxuri",
+		"hopeful":       "hope",
+		"conditional":   "condit",
+		"electricity":   "electr",
+		"adoption":      "adopt",
+		"skies":         "sky",
+		"dying":         "die",
+		"inning":        "inning",
+		"communism":     "communism",
+		"yelling":       "yell",
+		"by":            "by",
+	}
+
+	for word, want := range tests {
+		if got := stemEnglish(word); got != want {
+			t.Errorf("stemEnglish(%q) got %q, want %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Language holds morphology of a language: stemmer and a list of stop words
+type Language struct {
+	// ISO 639-1 code, e.g. "en"
+	Code      string
+	Stem      func(word string) string
+	StopWords map[string]bool
+}
+
+var languages = map[string]Language{}
+
+// Register adds language which can be detected and used by analyzers
+func Register(language Language) {
+	languages[language.Code] = language
+}
+
+// LanguageCode returns primary language of a locale, e.g. "en" for "en-US"
+func LanguageCode(locale string) string {
+	code := strings.ToLower(strings.TrimSpace(locale))
+	if index := strings.IndexAny(code, "-_"); index != -1 {
+		code = code[:index]
+	}
+	return code
+}
+
+// LookupLanguage finds registered language by code or locale like "en-US"
+func LookupLanguage(code string) (Language, bool) {
+	language, ok := languages[LanguageCode(code)]
+	return language, ok
+}
+
+func init() {
+	Register(English)
+	Register(Russian)
+}
+
+func newStopWords(words string) map[string]bool {
+	stopWords := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		stopWords[word] = true
+	}
+	return stopWords
+}
+
+// DetectLanguage guesses language of the text by the alphabet and the share of stop words.
+// Empty string is returned if language is not known.
+func DetectLanguage(text string) string {
+	var letters, cyrillic int
+	for _, char := range text {
+		if unicode.IsLetter(char) {
+			letters++
+			if unicode.Is(unicode.Cyrillic, char) {
+				cyrillic++
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	if cyrillic*2 > letters {
+		return Russian.Code
+	}
+
+	words := New().Tokenize(text)
+	var stopWords int
+	for _, word := range words {
+		if English.StopWords[word] {
+			stopWords++
+		}
+	}
+	if len(words) > 0 && stopWords*10 >= len(words) {
+		return English.Code
+	}
+
+	return ""
+}
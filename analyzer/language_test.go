@@ -0,0 +1,38 @@
+package analyzer
+
+import "testing"
+
+func TestLookupLanguage(t *testing.T) {
+	tests := map[string]string{
+		"en":    "en",
+		"en-US": "en",
+		"RU_ru": "ru",
+		"de":    "",
+		"":      "",
+	}
+
+	for code, want := range tests {
+		language, _ := LookupLanguage(code)
+		if language.Code != want {
+			t.Errorf("LookupLanguage(%q) got %q, want %q", code, language.Code, want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "SpaceX designs, manufactures and launches the world's most advanced rockets and spacecraft", want: "en"},
+		{text: "Ракета-носитель стартовала с космодрома, и корабль вышел на орбиту", want: "ru"},
+		{text: "Falcon 9 Dragon Starship", want: ""},
+		{text: "2022 / 12 / 31", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := DetectLanguage(test.text); got != test.want {
+			t.Errorf("DetectLanguage(%q) got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
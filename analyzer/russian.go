@@ -0,0 +1,136 @@
+package analyzer
+
+import "strings"
+
+var Russian = Language{
+	Code: "ru",
+	Stem: stemRussian,
+	StopWords: newStopWords(`и в во не что он на я с со как а то все она так его но да ты к у же вы за бы по
+		только ее мне было вот от меня еще нет о из ему теперь когда даже ну вдруг ли если уже или ни быть был
+		него до вас нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо ней для мы
+		тебя их чем была сам чтоб без будто чего раз тоже себе под будет ж тогда кто этот того потому этого
+		какой совсем ним здесь этом один почти мой тем чтобы нее сейчас были куда зачем всех никогда можно
+		при наконец два об другой хоть после над больше тот через эти нас про всего них какая много разве
+		три эту моя впрочем хорошо свою этой перед иногда лучше чуть том нельзя такой им более всегда
+		конечно всю между`),
+}
+
+var (
+	russianPerfectiveGerund1 = []string{"вшись", "вши", "в"}
+	russianPerfectiveGerund2 = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+	russianAdjective         = []string{"ими", "ыми", "его", "ого", "ему", "ому", "ее", "ие", "ые", "ое", "ей", "ий",
+		"ый", "ой", "ем", "им", "ым", "ом", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	russianParticiple1 = []string{"ем", "нн", "вш", "ющ", "щ"}
+	russianParticiple2 = []string{"ивш", "ывш", "ующ"}
+	russianReflexive   = []string{"ся", "сь"}
+	russianVerb1       = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны",
+		"ть", "й", "л", "н"}
+	russianVerb2 = []string{"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено", "ует",
+		"уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ят", "ит", "ыт", "ую", "ю"}
+	russianNoun = []string{"иями", "ями", "ами", "ией", "иям", "ием", "иях", "ев", "ов", "ие", "ье", "еи", "ии",
+		"ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья", "а", "е", "и", "й", "о",
+		"у", "ы", "ь", "ю", "я"}
+	russianSuperlative  = []string{"ейше", "ейш"}
+	russianDerivational = []string{"ость", "ост"}
+)
+
+func isRussianVowel(char rune) bool {
+	return strings.ContainsRune("аеиоуыэюя", char)
+}
+
+// russianWord is a word being stemmed with Snowball Russian algorithm. Only the part of
+// the word after rv can be changed.
+type russianWord struct {
+	value []rune
+	rv    int
+	r2    int
+}
+
+// longestSuffix returns length of the longest of the suffixes the word ends with inside RV
+func (w *russianWord) longestSuffix(suffixes []string) int {
+	longest := 0
+	for _, suffix := range suffixes {
+		length := len([]rune(suffix))
+		start := len(w.value) - length
+		if length > longest && start >= w.rv && string(w.value[start:]) == suffix {
+			longest = length
+		}
+	}
+	return longest
+}
+
+// removeEnding removes the longest ending from both of the groups. Endings of the first group
+// must follow "а" or "я" which are kept.
+func (w *russianWord) removeEnding(afterA []string, other []string) bool {
+	afterALength := w.longestSuffix(afterA)
+	otherLength := w.longestSuffix(other)
+
+	if otherLength >= afterALength {
+		if otherLength == 0 {
+			return false
+		}
+		w.value = w.value[:len(w.value)-otherLength]
+		return true
+	}
+
+	start := len(w.value) - afterALength
+	if start-1 < w.rv || (w.value[start-1] != 'а' && w.value[start-1] != 'я') {
+		return false
+	}
+	w.value = w.value[:start]
+	return true
+}
+
+func russianRegion(value []rune, start int) int {
+	for i := start + 1; i < len(value); i++ {
+		if !isRussianVowel(value[i]) && isRussianVowel(value[i-1]) {
+			return i + 1
+		}
+	}
+	return len(value)
+}
+
+// stemRussian implements Snowball Russian stemming algorithm
+func stemRussian(word string) string {
+	w := &russianWord{value: []rune(strings.ReplaceAll(word, "ё", "е"))}
+
+	w.rv = len(w.value)
+	for i, char := range w.value {
+		if isRussianVowel(char) {
+			w.rv = i + 1
+			break
+		}
+	}
+	w.r2 = russianRegion(w.value, russianRegion(w.value, 0))
+
+	// Step 1: endings of gerunds, adjectives, participles, verbs and nouns
+	if !w.removeEnding(russianPerfectiveGerund1, russianPerfectiveGerund2) {
+		w.removeEnding(nil, russianReflexive)
+		if w.removeEnding(nil, russianAdjective) {
+			w.removeEnding(russianParticiple1, russianParticiple2)
+		} else if !w.removeEnding(russianVerb1, russianVerb2) {
+			w.removeEnding(nil, russianNoun)
+		}
+	}
+
+	// Step 2
+	w.removeEnding(nil, []string{"и"})
+
+	// Step 3: derivational ending must be inside R2
+	if length := w.longestSuffix(russianDerivational); length > 0 && len(w.value)-length >= w.r2 {
+		w.value = w.value[:len(w.value)-length]
+	}
+
+	// Step 4: superlative ending, double "н" and soft sign
+	if w.removeEnding(nil, russianSuperlative) {
+		if w.longestSuffix([]string{"нн"}) > 0 {
+			w.value = w.value[:len(w.value)-1]
+		}
+	} else if w.longestSuffix([]string{"нн"}) > 0 {
+		w.value = w.value[:len(w.value)-1]
+	} else {
+		w.removeEnding(nil, []string{"ь"})
+	}
+
+	return string(w.value)
+}
@@ -0,0 +1,33 @@
+package analyzer
+
+import "testing"
+
+func TestStemRussian(t *testing.T) {
+	tests := map[string]string{
+		"запуск":           "запуск",
+		"запуски":          "запуск",
+		"запусков":         "запуск",
+		"ракеты":           "ракет",
+		"ракетой":          "ракет",
+		"важная":           "важн",
+		"важнее":           "важн",
+		"важнейшие":        "важн",
+		"вагоны":           "вагон",
+		"красивая":         "красив",
+		"бегающий":         "бега",
+		"сделавшись":       "сдела",
+		"программирование": "программирован",
+		"космическая":      "космическ",
+		"весенний":         "весен",
+		"нежность":         "нежност",
+		"умнейший":         "умн",
+		"кораблей":         "корабл",
+		"ёлка":             "елк",
+	}
+
+	for word, want := range tests {
+		if got := stemRussian(word); got != want {
+			t.Errorf("stemRussian(%q) got %q, want %q", word, got, want)
+		}
+	}
+}
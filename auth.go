@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Moranilt/search-engine/credentials"
+)
+
+var ErrLoginOnAnotherHost = errors.New("Login URL must be on the host of the credential")
+
+// HostCredentials are credentials of hosts by lowercase scheme and host name, e.g. "https://intranet.local".
+// A credential is added only to requests to its host with its scheme, so it isn't sent to other hosts
+// after redirects and isn't sent over HTTP to the host which was added with HTTPS
+type HostCredentials struct {
+	mutex  sync.RWMutex
+	byHost map[string]hostCredential
+}
+
+type hostCredential struct {
+	credential credentials.Credential
+	// Session of the login credential
+	session *loginSession
+}
+
+// Returns key of the credential of the URL, e.g. "https://intranet.local"
+func credentialKey(page *url.URL) string {
+	return strings.ToLower(page.Scheme + "://" + page.Hostname())
+}
+
+func (c *HostCredentials) set(host *url.URL, credential hostCredential) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.byHost == nil {
+		c.byHost = make(map[string]hostCredential)
+	}
+	c.byHost[credentialKey(host)] = credential
+}
+
+// Remove deletes the credential of the host by its name, e.g. "https://intranet.local/"
+func (c *HostCredentials) Remove(hostName string) {
+	host, err := url.Parse(hostName)
+	if err != nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.byHost, credentialKey(host))
+}
+
+func (c *HostCredentials) get(page *url.URL) (hostCredential, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	credential, ok := c.byHost[credentialKey(page)]
+	return credential, ok
+}
+
+// apply adds the credential of the host of the request. Login session and its cookies which were
+// added are returned, so the session is restarted if the response asks to log in
+func (c *HostCredentials) apply(request *http.Request) (*loginSession, http.CookieJar) {
+	credential, ok := c.get(request.URL)
+	if !ok {
+		return nil, nil
+	}
+	credential.credential.Apply(request)
+	if credential.session == nil {
+		return nil, nil
+	}
+	jar := credential.session.cookieJar()
+	for _, cookie := range jar.Cookies(request.URL) {
+		request.AddCookie(cookie)
+	}
+	return credential.session, jar
+}
+
+// loginSession keeps cookies of the login credential. The session is started again by submitting
+// the login form when the host asks to log in, e.g. after the session has expired
+type loginSession struct {
+	loginURL *url.URL
+	login    func() (http.CookieJar, error)
+
+	mutex sync.Mutex
+	jar   http.CookieJar
+}
+
+func (s *loginSession) cookieJar() http.CookieJar {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.jar
+}
+
+// restart logs in again unless the expired cookies were already replaced by a concurrent request
+func (s *loginSession) restart(expired http.CookieJar) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.jar != expired {
+		return nil
+	}
+	jar, err := s.login()
+	if err != nil {
+		return err
+	}
+	s.jar = jar
+	return nil
+}
+
+// loginRequired reports whether the response asks to log in: status 401, 403 or redirect to the login form
+func (s *loginSession) loginRequired(response *http.Response) bool {
+	switch response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	if response.StatusCode < http.StatusMultipleChoices || response.StatusCode >= http.StatusBadRequest {
+		return false
+	}
+	location, err := response.Location()
+	return err == nil && credentialKey(location) == credentialKey(s.loginURL) && location.Path == s.loginURL.Path
+}
+
+// SetCredential makes the fetcher authenticate on the host by its name, e.g. "https://intranet.local/".
+// Login credential starts the session by submitting the login form, which must be on the same host
+// with the same scheme
+func (f *Fetcher) SetCredential(hostName string, credential credentials.Credential) error {
+	if err := credential.Validate(); err != nil {
+		return err
+	}
+	host, err := url.Parse(hostName)
+	if err != nil {
+		return err
+	}
+	if credential.Kind != credentials.Login {
+		f.Credentials.set(host, hostCredential{credential: credential})
+		return nil
+	}
+
+	loginURL, err := url.Parse(credential.LoginURL)
+	if err != nil {
+		return err
+	}
+	if credentialKey(loginURL) != credentialKey(host) {
+		return ErrLoginOnAnotherHost
+	}
+
+	session := &loginSession{loginURL: loginURL, login: func() (http.CookieJar, error) {
+		return f.login(loginURL, credential)
+	}}
+	if err := session.restart(nil); err != nil {
+		return err
+	}
+	f.Credentials.set(host, hostCredential{credential: credential, session: session})
+	return nil
+}
+
+// login submits the login form of the credential and returns cookies of the started session
+func (f *Fetcher) login(loginURL *url.URL, credential credentials.Credential) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	form := make(url.Values, len(credential.LoginForm))
+	for name, value := range credential.LoginForm {
+		form.Set(name, value)
+	}
+
+	client := *f.Client
+	client.Jar = jar
+	client.Transport = f.transport(&HostCredentials{})
+	client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if len(via) >= f.MaxRedirects {
+			return ErrTooManyRedirects
+		}
+		if credentialKey(request.URL) != credentialKey(loginURL) {
+			return ErrCrossHostRedirect
+		}
+		return nil
+	}
+	response, err := client.PostForm(loginURL.String(), form)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Login on %s failed with status %s", loginURL.Hostname(), response.Status)
+	}
+	if len(jar.Cookies(loginURL)) == 0 {
+		return nil, fmt.Errorf("Login on %s didn't start a session", loginURL.Hostname())
+	}
+	return jar, nil
+}
@@ -0,0 +1,155 @@
+package autocomplete
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	SourceTerm   = "term"
+	SourcePhrase = "phrase"
+)
+
+// MaxCompletions is the number of best completions stored in every node of the trie
+const MaxCompletions = 10
+
+type Completion struct {
+	Text   string `json:"text"`
+	Count  int    `json:"count"`
+	Source string `json:"source"`
+}
+
+type node struct {
+	children map[rune]*node
+	entry    *Completion
+	top      []Completion
+}
+
+// Trie is a prefix tree where every node keeps its best completions, so lookups only walk
+// the prefix. It is immutable after Build.
+type Trie struct {
+	root *node
+}
+
+func NewTrie() *Trie {
+	return &Trie{root: &node{}}
+}
+
+// Insert adds text with its count. Counts of the same text are summed, phrases
+// win over terms as the source.
+func (t *Trie) Insert(text string, count int, source string) {
+	current := t.root
+	for _, char := range text {
+		if current.children == nil {
+			current.children = make(map[rune]*node)
+		}
+		child, ok := current.children[char]
+		if !ok {
+			child = &node{}
+			current.children[char] = child
+		}
+		current = child
+	}
+
+	if current.entry == nil {
+		current.entry = &Completion{Text: text, Source: source}
+	}
+	current.entry.Count += count
+	if source == SourcePhrase {
+		current.entry.Source = SourcePhrase
+	}
+}
+
+// Build computes best completions of every node. It must be called after all inserts.
+func (t *Trie) Build() *Trie {
+	build(t.root)
+	return t
+}
+
+func build(current *node) []Completion {
+	var completions []Completion
+	if current.entry != nil {
+		completions = append(completions, *current.entry)
+	}
+	for _, child := range current.children {
+		completions = append(completions, build(child)...)
+	}
+
+	sort.Slice(completions, func(i, j int) bool {
+		if completions[i].Count != completions[j].Count {
+			return completions[i].Count > completions[j].Count
+		}
+		return completions[i].Text < completions[j].Text
+	})
+	if len(completions) > MaxCompletions {
+		completions = completions[:MaxCompletions]
+	}
+
+	current.top = completions
+	return completions
+}
+
+// Complete returns up to limit best completions of the prefix
+func (t *Trie) Complete(prefix string, limit int) []Completion {
+	current := t.root
+	for _, char := range prefix {
+		current = current.children[char]
+		if current == nil {
+			return nil
+		}
+	}
+
+	if limit > len(current.top) {
+		limit = len(current.top)
+	}
+	return current.top[:limit]
+}
+
+// Suggester completes prefixes with past search phrases and indexed terms
+type Suggester struct {
+	phrases *Trie
+	terms   *Trie
+}
+
+func NewSuggester(phrases map[string]int, terms map[string]int) *Suggester {
+	suggester := &Suggester{phrases: NewTrie(), terms: NewTrie()}
+	for phrase, count := range phrases {
+		suggester.phrases.Insert(phrase, count, SourcePhrase)
+	}
+	for term, count := range terms {
+		suggester.terms.Insert(term, count, SourceTerm)
+	}
+	suggester.phrases.Build()
+	suggester.terms.Build()
+	return suggester
+}
+
+// Suggest returns up to limit completions of a normalized prefix. Past phrases are
+// completed as a whole and go first, indexed terms complete the last word of the prefix.
+func (s *Suggester) Suggest(prefix string, limit int) []Completion {
+	if prefix == "" || limit <= 0 {
+		return nil
+	}
+
+	completions := append([]Completion{}, s.phrases.Complete(prefix, limit)...)
+	unique := make(map[string]bool)
+	for _, completion := range completions {
+		unique[completion.Text] = true
+	}
+
+	lastWordStart := strings.LastIndex(prefix, " ") + 1
+	if lastWordStart < len(prefix) {
+		for _, completion := range s.terms.Complete(prefix[lastWordStart:], MaxCompletions) {
+			completion.Text = prefix[:lastWordStart] + completion.Text
+			if !unique[completion.Text] {
+				unique[completion.Text] = true
+				completions = append(completions, completion)
+			}
+		}
+	}
+
+	if len(completions) > limit {
+		completions = completions[:limit]
+	}
+	return completions
+}
@@ -0,0 +1,106 @@
+package autocomplete
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTrieComplete(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert("falcon", 10, SourceTerm)
+	trie.Insert("falcons", 2, SourceTerm)
+	trie.Insert("fairing", 5, SourceTerm)
+	trie.Insert("dragon", 7, SourceTerm)
+	trie.Insert("falcon", 3, SourcePhrase)
+	trie.Build()
+
+	t.Run("ranked by count", func(t *testing.T) {
+		got := trie.Complete("fa", 10)
+		want := []Completion{
+			{Text: "falcon", Count: 13, Source: SourcePhrase},
+			{Text: "fairing", Count: 5, Source: SourceTerm},
+			{Text: "falcons", Count: 2, Source: SourceTerm},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		got := trie.Complete("falc", 1)
+		want := []Completion{{Text: "falcon", Count: 13, Source: SourcePhrase}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("unknown prefix", func(t *testing.T) {
+		if got := trie.Complete("star", 10); len(got) != 0 {
+			t.Errorf("got %v, want nothing", got)
+		}
+	})
+}
+
+func TestSuggesterSuggest(t *testing.T) {
+	suggester := NewSuggester(
+		map[string]int{"launch window": 4, "launch schedule": 9, "dragon": 1},
+		map[string]int{"launch": 20, "window": 3, "weather": 6, "dragon": 5},
+	)
+
+	tests := []struct {
+		prefix string
+		want   []Completion
+	}{
+		{
+			prefix: "launch",
+			want: []Completion{
+				{Text: "launch schedule", Count: 9, Source: SourcePhrase},
+				{Text: "launch window", Count: 4, Source: SourcePhrase},
+				{Text: "launch", Count: 20, Source: SourceTerm},
+			},
+		},
+		{
+			prefix: "launch w",
+			want: []Completion{
+				{Text: "launch window", Count: 4, Source: SourcePhrase},
+				{Text: "launch weather", Count: 6, Source: SourceTerm},
+			},
+		},
+		{
+			prefix: "drag",
+			want: []Completion{
+				{Text: "dragon", Count: 1, Source: SourcePhrase},
+			},
+		},
+		{
+			prefix: "launch ",
+			want: []Completion{
+				{Text: "launch schedule", Count: 9, Source: SourcePhrase},
+				{Text: "launch window", Count: 4, Source: SourcePhrase},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.prefix, func(t *testing.T) {
+			got := suggester.Suggest(test.prefix, 10)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func BenchmarkSuggesterSuggest(b *testing.B) {
+	terms := make(map[string]int)
+	for i := 0; i < 100000; i++ {
+		terms[fmt.Sprintf("term%d", i)] = i % 100
+	}
+	suggester := NewSuggester(map[string]int{"term search": 10}, terms)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		suggester.Suggest("term 12", 10)
+	}
+}
@@ -0,0 +1,152 @@
+// Package credentials describes how the crawler authenticates on a host and keeps the secrets
+// encrypted at rest
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type Kind string
+
+const (
+	Basic  Kind = "basic"
+	Bearer Kind = "bearer"
+	// Custom headers, e.g. API key
+	Headers Kind = "headers"
+	// Cookies of the session which is started by submitting a login form
+	Login Kind = "login"
+)
+
+// KeySize is the size of the AES-256 key
+const KeySize = 32
+
+var (
+	ErrInvalidKey = errors.New("Credentials key must be 32 bytes encoded in hex")
+	ErrDecrypt    = errors.New("Credential can't be decrypted")
+)
+
+// Credential is the secret which is used to request pages of one host
+type Credential struct {
+	Kind     Kind              `json:"kind"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	// Form fields posted to LoginURL, e.g. {"user": "bot", "password": "secret"}
+	LoginURL  string            `json:"login_url,omitempty"`
+	LoginForm map[string]string `json:"login_form,omitempty"`
+}
+
+// Validate checks that the fields of the credential kind are set
+func (c Credential) Validate() error {
+	switch c.Kind {
+	case Basic:
+		if c.Username == "" {
+			return errors.New("Username of basic credential is empty")
+		}
+	case Bearer:
+		if c.Token == "" {
+			return errors.New("Token of bearer credential is empty")
+		}
+	case Headers:
+		if len(c.Headers) == 0 {
+			return errors.New("Headers credential has no headers")
+		}
+	case Login:
+		if c.LoginURL == "" || len(c.LoginForm) == 0 {
+			return errors.New("Login credential needs login_url and login_form")
+		}
+	default:
+		return errors.New("Unknown credential kind " + string(c.Kind) + ", expected one of basic, bearer, headers, login")
+	}
+	return nil
+}
+
+// Apply adds the credential to the request. Session cookies of Login credential are added by the
+// fetcher which has done the login
+func (c Credential) Apply(request *http.Request) {
+	switch c.Kind {
+	case Basic:
+		request.SetBasicAuth(c.Username, c.Password)
+	case Bearer:
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	case Headers:
+		for name, value := range c.Headers {
+			request.Header.Set(name, value)
+		}
+	}
+}
+
+// Cipher encrypts credentials with AES-GCM, so they are stored without plain secrets
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// LoadCipher reads hex encoded key from the file, e.g. generated by "openssl rand -hex 32"
+func LoadCipher(path string) (*Cipher, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return NewCipher(key)
+}
+
+// Encrypt returns the credential sealed with random nonce, encoded in base64
+func (c *Cipher) Encrypt(credential Credential) (string, error) {
+	plaintext, err := json.Marshal(credential)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(encrypted string) (Credential, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return Credential{}, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return Credential{}, ErrDecrypt
+	}
+
+	var credential Credential
+	if err := json.Unmarshal(plaintext, &credential); err != nil {
+		return Credential{}, ErrDecrypt
+	}
+	return credential, nil
+}
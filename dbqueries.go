@@ -1,36 +1,105 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Moranilt/search-engine/pagerank"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type Host struct {
 	Id           int    `db:"id"`
 	Name         string `db:"name"`
 	IsSearchable bool   `db:"is_searchable"`
-	CreatedAt    string `db:"created_at"`
-	tx           *sqlx.Tx
+	// Encrypted credential which is used to request pages of the host
+	CredentialId *int `db:"credential_id"`
+	// Kind and values of HostScope, see Scope
+	ScopeKind   string         `db:"scope_kind"`
+	ScopeValues pq.StringArray `db:"scope_values"`
+	CreatedAt   string         `db:"created_at"`
+	tx          *sqlx.Tx
+}
+
+// Returns host name without scheme, e.g. "www.spacex.com" for "https://www.spacex.com/"
+func (h Host) Hostname() string {
+	hostURL, err := url.Parse(h.Name)
+	if err != nil || hostURL.Host == "" {
+		return strings.Trim(h.Name, "/")
+	}
+	return hostURL.Hostname()
+}
+
+// Resolves href found on the source endpoint to the path of endpoint of the same host.
+// Returns false for links to other hosts
+func (h Host) ResolveLink(source string, href string) (string, bool) {
+	target, ok := h.resolveURL(source, href)
+	if !ok || !strings.EqualFold(target.Hostname(), h.Hostname()) {
+		return "", false
+	}
+	return endpointPath(target), true
+}
+
+// Resolves href found on the source endpoint to absolute URL of a web page
+func (h Host) resolveURL(source string, href string) (*url.URL, bool) {
+	hostURL, err := url.Parse(h.Name)
+	if err != nil {
+		return nil, false
+	}
+	sourceURL, err := hostURL.Parse(source)
+	if err != nil {
+		return nil, false
+	}
+	target, err := sourceURL.Parse(href)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, false
+	}
+	return target, true
+}
+
+// Returns path of the endpoint with its query, e.g. "/launches?page=2"
+func endpointPath(page *url.URL) string {
+	path := page.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if page.RawQuery != "" {
+		path += "?" + page.RawQuery
+	}
+	return path
+}
+
+// Returns URL of the endpoint of the host by its path, e.g. "http://localhost:8080/launches?page=2"
+func endpointURL(hostName string, endpoint string) (*url.URL, error) {
+	hostURL, err := url.Parse(hostName)
+	if err != nil {
+		return nil, err
+	}
+	return hostURL.Parse(endpoint)
 }
 
 func (h Host) GetEndpoints(db *sqlx.DB) (endpoints []EndpointBySearchPhrase) {
-	db.Select(&endpoints, "SELECT name as path, titles.value as title FROM endpoints INNER JOIN titles ON titles.endpoint_id=endpoints.id WHERE endpoints.host_id=$1", h.Id)
+	// The latest version of the title is returned, endpoints which are known only by links have no title
+	db.Select(&endpoints, "SELECT e.id, e.name as path, "+endpointTitleColumn+", e.authority, "+endpointMetadataColumns+" FROM endpoints e WHERE e.host_id=$1", h.Id)
 	return
 }
 
 func (h Host) GetEndpointsWithoutSearchPhrase(db *sqlx.DB, searchPhrase string) (endpoints []string) {
-	db.Select(&endpoints, `SELECT 
-	e.name as path
-	FROM endpoints e 
-	INNER JOIN hosts h ON h.id=e.host_id 
-	INNER JOIN titles ON titles.endpoint_id=e.id
-	LEFT JOIN (
-		SELECT 
-		ep.endpoint_id, 
-		phrases.name as phrase 
-		FROM phrases 
-		INNER JOIN endpoints_phrases ep 
-		ON ep.phrase_id=phrases.id
-	) as p ON e.id=p.endpoint_id WHERE p.phrase != $1 OR p.phrase IS NULL`, searchPhrase)
+	db.Select(&endpoints, `SELECT DISTINCT e.name as path
+	FROM endpoints e
+	WHERE e.host_id=$1 AND NOT EXISTS (
+		SELECT FROM endpoints_phrases ep
+		INNER JOIN phrases ON ep.phrase_id=phrases.id
+		WHERE ep.endpoint_id=e.id AND phrases.name=$2
+	) AND NOT EXISTS (
+		SELECT FROM endpoints_missing_phrases emp
+		INNER JOIN phrases ON emp.phrase_id=phrases.id
+		WHERE emp.endpoint_id=e.id AND phrases.name=$2 AND emp.content_hash=e.content_hash
+	)`, h.Id, searchPhrase)
 
 	return
 }
@@ -45,6 +114,11 @@ func (h Host) GetEndpointsWithSearchPhrase(db *sqlx.DB, searchPhrase string) (en
 	return
 }
 
+func (h Host) GetFeeds(db *sqlx.DB) (feeds []HostFeed, err error) {
+	err = db.Select(&feeds, SelectHostFeeds, h.Id)
+	return
+}
+
 func (h Host) EndpointContains(db *sqlx.DB, endpoint string) (exists bool) {
 	db.Get(&exists, "SELECT EXISTS (SELECT FROM endpoints WHERE host_id=$1 AND name=$2)", h.Id, endpoint)
 	return
@@ -54,23 +128,201 @@ func (h *Host) MustBegin(db *sqlx.DB) {
 	h.tx = db.MustBegin()
 }
 
-func (h Host) StoreEndpointByPhrase(endpoint string, searchPhrase string, title string) {
-	h.tx.MustExec(
+func (h *Host) Begin(db *sqlx.DB) (err error) {
+	h.tx, err = db.Beginx()
+	return
+}
+
+// Postgres rejects NUL characters in text, though pages may contain them
+func withoutNUL(value string) string {
+	return strings.ReplaceAll(value, "\x00", "")
+}
+
+func withoutNULs(values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = withoutNUL(value)
+	}
+	return result
+}
+
+func (h Host) StoreEndpointByPhrase(endpoint string, searchPhrase string, title string) error {
+	_, err := h.tx.Exec(
 		"SELECT create_endpoint_phrase_title($1, $2, $3, $4)",
 		h.Id,
 		endpoint,
 		searchPhrase,
-		title,
+		withoutNUL(title),
 	)
+	return err
 }
 
-func (h Host) NewEndpoint(endpoint string, title string) {
-	h.tx.MustExec(
-		"SELECT create_endpoint_title($1,$2,$3)",
+// Remembers that the page with given content hash doesn't contain searchPhrase
+func (h Host) StoreEndpointWithoutPhrase(endpoint string, searchPhrase string, contentHash string) error {
+	_, err := h.tx.Exec(
+		"SELECT create_endpoint_missing_phrase($1, $2, $3, $4)",
 		h.Id,
 		endpoint,
-		title,
+		searchPhrase,
+		contentHash,
 	)
+	return err
+}
+
+// Replaces vocabulary of the endpoint which is used for spelling corrections
+func (h Host) StoreEndpointTerms(endpoint string, terms []string) error {
+	_, err := h.tx.Exec(
+		"SELECT set_endpoint_terms($1, $2, $3)",
+		h.Id,
+		endpoint,
+		pq.Array(terms),
+	)
+	return err
+}
+
+// Replaces outgoing links of the endpoint. Targets are paths of the host's endpoints
+// and anchors are texts of the links
+func (h Host) StoreEndpointLinks(endpoint string, targets []string, anchors []string) error {
+	_, err := h.tx.Exec(
+		"SELECT set_endpoint_links($1, $2, $3, $4)",
+		h.Id,
+		endpoint,
+		pq.Array(targets),
+		pq.Array(withoutNULs(anchors)),
+	)
+	return err
+}
+
+// Stores links of the endpoint to pages of other hosts which are out of scope of the host
+func (h Host) StoreExternalLinks(endpoint string, targets []*url.URL, anchors []string) error {
+	urls := make([]string, len(targets))
+	hosts := make([]string, len(targets))
+	for i, target := range targets {
+		urls[i] = target.String()
+		hosts[i] = strings.ToLower(target.Hostname())
+	}
+	_, err := h.tx.Exec(
+		"SELECT set_endpoint_external_links($1, $2, $3, $4, $5)",
+		h.Id,
+		endpoint,
+		pq.Array(urls),
+		pq.Array(hosts),
+		pq.Array(withoutNULs(anchors)),
+	)
+	return err
+}
+
+// Creates endpoint of the page of another host. Host with the same host name is used regardless
+// of scheme and port, it is created when it doesn't exist. The endpoint has no title until it is
+// requested by the search as other unchecked endpoints
+func (h Host) StoreFollowedLink(target *url.URL) error {
+	_, err := h.tx.Exec("SELECT create_linked_endpoint($1, $2)", hostNameOf(target), endpointPath(target))
+	return err
+}
+
+// Returns texts of links to the host's endpoints from other endpoints by paths of targets
+func (h Host) GetIncomingAnchors(db *sqlx.DB) map[string][]string {
+	var rows []struct {
+		Path   string `db:"path"`
+		Anchor string `db:"anchor_text"`
+	}
+	db.Select(&rows, SelectIncomingAnchors, h.Id)
+
+	anchors := make(map[string][]string)
+	for _, row := range rows {
+		anchors[row.Path] = append(anchors[row.Path], row.Anchor)
+	}
+	return anchors
+}
+
+// Returns links between endpoints of the host
+func (h Host) GetLinkGraph(db *sqlx.DB) (*pagerank.Graph, error) {
+	var endpoints []int64
+	err := db.Select(&endpoints, "SELECT id FROM endpoints WHERE host_id=$1", h.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []struct {
+		Source int `db:"source_id"`
+		Target int `db:"target_id"`
+	}
+	err = db.Select(&links, SelectHostLinks, h.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := pagerank.NewGraph()
+	for _, endpoint := range endpoints {
+		graph.AddNode(int(endpoint))
+	}
+	for _, link := range links {
+		graph.AddEdge(link.Source, link.Target)
+	}
+	return graph, nil
+}
+
+// Stores authority scores of the host's endpoints by their ids
+func (h Host) StoreAuthority(db *sqlx.DB, authority map[int]float64) error {
+	ids := make([]int64, 0, len(authority))
+	scores := make([]float64, 0, len(authority))
+	for id, score := range authority {
+		ids = append(ids, int64(id))
+		scores = append(scores, score)
+	}
+	_, err := db.Exec(UpdateEndpointsAuthority, h.Id, pq.Array(ids), pq.Array(scores))
+	return err
+}
+
+// Stores extracted text of the endpoint which is used for snippets
+func (h Host) StoreEndpointContent(endpoint string, content string) error {
+	_, err := h.tx.Exec(
+		"UPDATE endpoints SET content=$3 WHERE host_id=$1 AND name=$2",
+		h.Id,
+		endpoint,
+		withoutNUL(content),
+	)
+	return err
+}
+
+// Returns stored text of the endpoints by their paths
+func (h Host) GetEndpointsContent(db *sqlx.DB, endpoints []string) map[string]string {
+	var rows []struct {
+		Path    string `db:"path"`
+		Content string `db:"content"`
+	}
+	db.Select(&rows, "SELECT name as path, COALESCE(content, '') as content FROM endpoints WHERE host_id=$1 AND name=ANY($2)", h.Id, pq.Array(endpoints))
+
+	contents := make(map[string]string, len(rows))
+	for _, row := range rows {
+		contents[row.Path] = row.Content
+	}
+	return contents
+}
+
+// Stores crawled endpoint with its metadata. Cached found and missing phrases are dropped if the content hash has changed
+func (h Host) NewEndpoint(endpoint string, title string, metadata EndpointMetadata) error {
+	_, err := h.tx.Exec(
+		"SELECT create_crawled_endpoint($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)",
+		h.Id,
+		endpoint,
+		withoutNUL(title),
+		metadata.ContentHash,
+		metadata.Language,
+		metadata.StatusCode,
+		metadata.ContentType,
+		metadata.ContentLength,
+		metadata.LastModified,
+		withoutNUL(metadata.Description),
+		metadata.CanonicalURL,
+		metadata.OutboundLinks,
+		metadata.SimHash,
+		metadata.Truncated,
+		metadata.FinalURL,
+		metadata.SchemaTypes,
+		string(metadata.StructuredData),
+	)
+	return err
 }
 
 func (h *Host) Commit() error {
@@ -79,9 +331,112 @@ func (h *Host) Commit() error {
 	return err
 }
 
+func (h *Host) Rollback() error {
+	err := h.tx.Rollback()
+	h.tx = nil
+	return err
+}
+
+// HostFeed is the feed of the host with validators of its last response, so polls of
+// the unchanged feed are answered with 304
+type HostFeed struct {
+	Id           int        `db:"id" json:"-"`
+	HostId       int        `db:"host_id" json:"-"`
+	Path         string     `db:"path" json:"path"`
+	Title        string     `db:"title" json:"title"`
+	ETag         string     `db:"etag" json:"-"`
+	LastModified string     `db:"last_modified" json:"-"`
+	PolledAt     *time.Time `db:"polled_at" json:"polled_at"`
+	CreatedAt    time.Time  `db:"created_at" json:"-"`
+}
+
 type EndpointBySearchPhrase struct {
+	Id    int    `db:"id" json:"id,omitempty"`
 	Path  string `db:"path" json:"path"`
 	Title string `db:"title" json:"title"`
+	// PageRank of the endpoint among endpoints of its host, from 0 to 1
+	Authority float64 `db:"authority" json:"authority"`
+	EndpointMetadata
+}
+
+// Reports whether the endpoint is known only by links to it, it hasn't been crawled yet
+func (e EndpointBySearchPhrase) IsLinkedOnly() bool {
+	return e.CrawledAt == nil && e.Title == ""
+}
+
+// EndpointMetadata describes the response of the endpoint at the last crawl
+type EndpointMetadata struct {
+	StatusCode    int        `db:"status_code" json:"status_code,omitempty"`
+	ContentType   string     `db:"content_type" json:"content_type,omitempty"`
+	ContentLength int64      `db:"content_length" json:"content_length,omitempty"`
+	ContentHash   string     `db:"content_hash" json:"content_hash,omitempty"`
+	LastModified  *time.Time `db:"last_modified" json:"last_modified,omitempty"`
+	Description   string     `db:"description" json:"description,omitempty"`
+	CanonicalURL  string     `db:"canonical_url" json:"canonical_url,omitempty"`
+	Language      string     `db:"language" json:"language,omitempty"`
+	OutboundLinks int        `db:"outbound_links" json:"outbound_links,omitempty"`
+	// Fingerprint of the text stored as signed number, see simhash.Fingerprint
+	SimHash int64 `db:"simhash" json:"-"`
+	// Body was larger than the maximum size and only its beginning is indexed
+	Truncated bool `db:"truncated" json:"truncated,omitempty"`
+	// URL of the response after redirects, empty if the page wasn't redirected
+	FinalURL string `db:"final_url" json:"final_url,omitempty"`
+	// schema.org types of structured data, e.g. "Article"
+	SchemaTypes    pq.StringArray `db:"schema_types" json:"schema_types,omitempty"`
+	StructuredData JSONData       `db:"structured_data" json:"structured_data,omitempty"`
+	// Set by the database when the endpoint is stored
+	CrawledAt *time.Time `db:"crawled_at" json:"crawled_at,omitempty"`
+}
+
+// JSONData is JSON value of JSONB column, NULL is empty
+type JSONData json.RawMessage
+
+func (d *JSONData) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*d = nil
+	case []byte:
+		*d = append(JSONData(nil), src...)
+	case string:
+		*d = JSONData(src)
+	default:
+		return fmt.Errorf("Can't scan %T into JSONData", src)
+	}
+	return nil
+}
+
+func (d JSONData) MarshalJSON() ([]byte, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return json.RawMessage(d).MarshalJSON()
+}
+
+// EndpointDetails is the endpoint with cached search phrases which explain why it is or isn't found
+type EndpointDetails struct {
+	Host string `db:"host" json:"host"`
+	EndpointBySearchPhrase
+	Phrases []string `json:"phrases"`
+	// Phrases which are missing in the current content of the endpoint
+	MissingPhrases []string `json:"missing_phrases"`
+}
+
+// Returns endpoint by id, sql.ErrNoRows if it doesn't exist
+func GetEndpoint(db *sqlx.DB, id int) (endpoint EndpointDetails, err error) {
+	err = db.Get(&endpoint, SelectEndpointById, id)
+	if err != nil {
+		return endpoint, err
+	}
+
+	endpoint.Phrases = []string{}
+	err = db.Select(&endpoint.Phrases, SelectEndpointPhrases, id)
+	if err != nil {
+		return endpoint, err
+	}
+
+	endpoint.MissingPhrases = []string{}
+	err = db.Select(&endpoint.MissingPhrases, SelectEndpointMissingPhrases, id)
+	return endpoint, err
 }
 
 func (e EndpointBySearchPhrase) GetSearchPhrases(db *sqlx.DB) []string {
@@ -100,6 +455,7 @@ const (
 	CreateHostQuery                  = "INSERT INTO hosts (name, is_searchable) VALUES ($1, false) ON CONFLICT (name) DO NOTHING"
 	SelectNameOfHosts                = "SELECT name FROM hosts"
 	SelectAllFromHosts               = "SELECT * FROM hosts"
+	SelectSearchableHosts            = "SELECT * FROM hosts WHERE is_searchable"
 	SelectHostByName                 = "SELECT * FROM hosts WHERE name=$1"
 	SelectAllEndpointsBySearchPhrase = `
 	SELECT e.name as path, titles.value as title FROM endpoints e 
@@ -113,4 +469,65 @@ const (
 	GetEndpointsWithSearchPhrases = `SELECT endpoints.name as name, array_agg(phrases.name)as phrases FROM endpoints 
 	INNER JOIN endpoints_phrases ep ON endpoints.id=ep.endpoint_id 
 	INNER JOIN phrases ON phrases.id=ep.phrase_id GROUP BY endpoints.name`
+	SelectTermsFrequency = `SELECT terms.name, COUNT(et.endpoint_id) as frequency FROM terms
+	INNER JOIN endpoints_terms et ON et.term_id=terms.id GROUP BY terms.name`
+	SelectSearchedPhrases = "SELECT name, searches as frequency FROM phrases WHERE searches > 0"
+	CountPhraseSearch     = "INSERT INTO phrases (name, searches) VALUES ($1, 1) ON CONFLICT (name) DO UPDATE SET searches=phrases.searches+1"
+	// Columns of EndpointMetadata for endpoints aliased as "e"
+	endpointMetadataColumns = `COALESCE(e.status_code, 0) as status_code, COALESCE(e.content_type, '') as content_type,
+	COALESCE(e.content_length, 0) as content_length, COALESCE(e.content_hash, '') as content_hash, e.last_modified,
+	COALESCE(e.description, '') as description, COALESCE(e.canonical_url, '') as canonical_url,
+	COALESCE(e.language, '') as language, COALESCE(e.outbound_links, 0) as outbound_links,
+	COALESCE(e.simhash, 0) as simhash, e.truncated, COALESCE(e.final_url, '') as final_url,
+	COALESCE(e.schema_types, '{}') as schema_types, e.structured_data, e.crawled_at`
+	// The latest title of endpoint aliased as "e"
+	endpointTitleColumn = "COALESCE((SELECT value FROM titles WHERE endpoint_id=e.id ORDER BY id DESC LIMIT 1), '') as title"
+	SelectEndpointById  = `SELECT e.id, h.name as host, e.name as path, ` + endpointTitleColumn + `, e.authority, ` + endpointMetadataColumns + `
+	FROM endpoints e INNER JOIN hosts h ON h.id=e.host_id WHERE e.id=$1`
+	SelectEndpointPhrases = `SELECT phrases.name FROM endpoints_phrases ep
+	INNER JOIN phrases ON phrases.id=ep.phrase_id WHERE ep.endpoint_id=$1 ORDER BY phrases.name`
+	SelectEndpointMissingPhrases = `SELECT phrases.name FROM endpoints_missing_phrases emp
+	INNER JOIN phrases ON phrases.id=emp.phrase_id
+	INNER JOIN endpoints e ON e.id=emp.endpoint_id AND e.content_hash=emp.content_hash
+	WHERE emp.endpoint_id=$1 ORDER BY phrases.name`
+	// Marks endpoints of the host which are known only by links as attempted and returns them
+	QueueLinkedEndpoints = `UPDATE endpoints SET crawl_attempted_at=CURRENT_TIMESTAMP WHERE id IN (SELECT e.id FROM endpoints e
+	WHERE e.host_id=$1 AND e.crawled_at IS NULL AND NOT EXISTS (SELECT FROM titles WHERE endpoint_id=e.id)
+	ORDER BY e.crawl_attempted_at NULLS FIRST, e.id LIMIT $2) RETURNING name`
+	SelectHostLinks = `SELECT DISTINCT l.source_id, l.target_id FROM links l
+	INNER JOIN endpoints e ON e.id=l.source_id WHERE e.host_id=$1`
+	SelectIncomingAnchors = `SELECT DISTINCT e.name as path, l.anchor_text FROM links l
+	INNER JOIN endpoints e ON e.id=l.target_id
+	WHERE e.host_id=$1 AND l.source_id!=l.target_id AND l.anchor_text!=''`
+	SetHostCredential     = "SELECT set_host_credential($1, $2, $3)"
+	DeleteHostCredential  = "DELETE FROM credentials WHERE id=(SELECT credential_id FROM hosts WHERE name=$1)"
+	SelectHostCredentials = `SELECT h.name as host, c.secret FROM hosts h
+	INNER JOIN credentials c ON c.id=h.credential_id`
+	UpdateHostScope       = "UPDATE hosts SET scope_kind=$2, scope_values=$3 WHERE name=$1"
+	SelectHostSuggestions = `SELECT el.host, COUNT(DISTINCT el.source_id) as links FROM external_links el
+	WHERE NOT EXISTS (SELECT FROM hosts WHERE host_hostname(name)=el.host)
+	GROUP BY el.host ORDER BY links DESC, el.host LIMIT $1 OFFSET $2`
+	// Host with the host name of the given one regardless of scheme and port, it is created when there is no such host
+	SelectLinkedHost         = "SELECT h.* FROM create_linked_host($1) AS linked_id INNER JOIN hosts h ON h.id=linked_id"
+	AddHostFeed              = "INSERT INTO feeds (host_id, path) VALUES ($1, $2) ON CONFLICT (host_id, path) DO NOTHING"
+	DeleteHostFeed           = "DELETE FROM feeds WHERE host_id=(SELECT id FROM hosts WHERE name=$1) AND path=$2"
+	SelectHostFeeds          = "SELECT * FROM feeds WHERE host_id=$1 ORDER BY path"
+	SelectHostsWithFeeds     = "SELECT * FROM hosts h WHERE is_searchable AND EXISTS (SELECT FROM feeds WHERE host_id=h.id)"
+	UpdateFeedPoll           = "UPDATE feeds SET title=$2, etag=$3, last_modified=$4, polled_at=CURRENT_TIMESTAMP WHERE id=$1"
+	UpdateHostFeedPoll       = "UPDATE feeds SET title=$3, etag=$4, last_modified=$5, polled_at=CURRENT_TIMESTAMP WHERE host_id=$1 AND path=$2"
+	UpdateEndpointsAuthority = `UPDATE endpoints SET authority=ranks.authority
+	FROM unnest($2::int[], $3::float8[]) AS ranks(id, authority)
+	WHERE endpoints.id=ranks.id AND endpoints.host_id=$1`
 )
+
+// HostSuggestion is a host which isn't added, but is linked from pages of added hosts
+type HostSuggestion struct {
+	Host string `db:"host" json:"host"`
+	// Number of pages which link to the host
+	Links int `db:"links" json:"links"`
+}
+
+type TermFrequency struct {
+	Name      string `db:"name"`
+	Frequency int    `db:"frequency"`
+}
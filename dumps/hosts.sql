@@ -1,13 +1,41 @@
+-- Secrets are encrypted by the application, see package credentials
+CREATE TABLE credentials (
+  id SERIAL PRIMARY KEY,
+  kind VARCHAR NOT NULL,
+  secret TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
 CREATE TABLE hosts (
   id SERIAL PRIMARY KEY,
   name VARCHAR UNIQUE,
   is_searchable BOOLEAN,
-  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+  credential_id INT,
+  -- Pages which are followed by links, see HostScope
+  scope_kind VARCHAR DEFAULT 'host' NOT NULL,
+  scope_values VARCHAR[] DEFAULT '{}' NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  FOREIGN KEY (credential_id) REFERENCES credentials (id) ON DELETE SET NULL
+);
+
+-- RSS, Atom or JSON feeds which are polled for new pages of the host
+CREATE TABLE feeds (
+  id SERIAL PRIMARY KEY,
+  host_id INT NOT NULL,
+  path VARCHAR NOT NULL,
+  title VARCHAR DEFAULT '' NOT NULL,
+  etag VARCHAR DEFAULT '' NOT NULL,
+  last_modified VARCHAR DEFAULT '' NOT NULL,
+  polled_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  UNIQUE (host_id, path),
+  FOREIGN KEY (host_id) REFERENCES hosts (id) ON DELETE CASCADE
 );
 
 CREATE TABLE phrases (
   id SERIAL PRIMARY KEY,
   name VARCHAR UNIQUE,
+  searches INT DEFAULT 0 NOT NULL,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
 );
 
@@ -15,7 +43,27 @@ CREATE TABLE endpoints (
   id SERIAL PRIMARY KEY,
   host_id INT NOT NULL,
   name VARCHAR NOT NULL,
+  status_code INT,
+  content_type VARCHAR,
+  content_length BIGINT,
+  content_hash VARCHAR,
+  last_modified TIMESTAMP WITH TIME ZONE,
+  description TEXT,
+  canonical_url VARCHAR,
+  language VARCHAR,
+  outbound_links INT,
+  simhash BIGINT,
+  truncated BOOLEAN DEFAULT false NOT NULL,
+  final_url VARCHAR,
+  schema_types VARCHAR[],
+  structured_data JSONB,
+  content TEXT,
+  crawled_at TIMESTAMP WITH TIME ZONE,
+  -- Last time the endpoint which is known only by links was taken by the crawl queue
+  crawl_attempted_at TIMESTAMP WITH TIME ZONE,
+  authority DOUBLE PRECISION DEFAULT 0 NOT NULL,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  UNIQUE (host_id, name),
   FOREIGN KEY (host_id) REFERENCES hosts (id) ON DELETE CASCADE
 );
 
@@ -34,6 +82,47 @@ CREATE TABLE endpoints_phrases (
   FOREIGN KEY (endpoint_id) REFERENCES endpoints (id) ON DELETE CASCADE
 );
 
+CREATE TABLE endpoints_missing_phrases (
+  phrase_id INT,
+  endpoint_id INT,
+  content_hash VARCHAR NOT NULL,
+  UNIQUE (phrase_id, endpoint_id),
+  FOREIGN KEY (phrase_id) REFERENCES phrases (id) ON DELETE CASCADE,
+  FOREIGN KEY (endpoint_id) REFERENCES endpoints (id) ON DELETE CASCADE
+);
+
+CREATE TABLE terms (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR UNIQUE
+);
+
+CREATE TABLE endpoints_terms (
+  term_id INT,
+  endpoint_id INT,
+  UNIQUE (term_id, endpoint_id),
+  FOREIGN KEY (term_id) REFERENCES terms (id) ON DELETE CASCADE,
+  FOREIGN KEY (endpoint_id) REFERENCES endpoints (id) ON DELETE CASCADE
+);
+
+CREATE TABLE links (
+  source_id INT NOT NULL,
+  target_id INT NOT NULL,
+  anchor_text VARCHAR DEFAULT '' NOT NULL,
+  UNIQUE (source_id, target_id, anchor_text),
+  FOREIGN KEY (source_id) REFERENCES endpoints (id) ON DELETE CASCADE,
+  FOREIGN KEY (target_id) REFERENCES endpoints (id) ON DELETE CASCADE
+);
+
+-- Links to pages of other hosts out of scope of the source host
+CREATE TABLE external_links (
+  source_id INT NOT NULL,
+  url VARCHAR NOT NULL,
+  host VARCHAR NOT NULL,
+  anchor_text VARCHAR DEFAULT '' NOT NULL,
+  UNIQUE (source_id, url, anchor_text),
+  FOREIGN KEY (source_id) REFERENCES endpoints (id) ON DELETE CASCADE
+);
+
 CREATE OR REPLACE FUNCTION create_phrase("search_phrase" text)
 	RETURNS integer
 	LANGUAGE plpgsql
@@ -57,15 +146,12 @@ AS
 $BODY$
 	DECLARE endpoint_id integer;
 	BEGIN
-		if EXISTS (SELECT FROM endpoints WHERE host_id=host AND name=endpoint) THEN
-			SELECT id INTO endpoint_id 
-        FROM endpoints 
-        WHERE host_id=host AND name=endpoint;
-		ELSE
-			INSERT INTO 
-      endpoints (host_id, name) 
-      VALUES(host, endpoint) 
-      RETURNING id INTO endpoint_id;
+		-- Concurrent crawls of the same page get the same endpoint
+		INSERT INTO endpoints (host_id, name) VALUES (host, endpoint)
+			ON CONFLICT (host_id, name) DO NOTHING
+			RETURNING id INTO endpoint_id;
+		IF NOT FOUND THEN
+			SELECT id INTO endpoint_id FROM endpoints WHERE host_id=host AND name=endpoint;
 		END IF;
 		return endpoint_id;
 	END;
@@ -77,7 +163,8 @@ CREATE OR REPLACE FUNCTION create_title("endpoint" integer, "title" text)
 AS
 $BODY$
 	BEGIN
-		IF NOT EXISTS (SELECT FROM titles WHERE endpoint_id=endpoint AND value=title) THEN
+		-- Titles are versions, a title which was changed back is the latest version again
+		IF title IS DISTINCT FROM (SELECT value FROM titles WHERE endpoint_id=endpoint ORDER BY id DESC LIMIT 1) THEN
 			INSERT INTO titles (endpoint_id, value) VALUES (endpoint, title);
 		END IF;
 	END;
@@ -113,4 +200,191 @@ $BODY$
 	END;
 $BODY$;
 
+CREATE OR REPLACE FUNCTION set_endpoint_content_hash("endpoint" integer, "hash" text)
+	RETURNS void
+	LANGUAGE plpgsql
+AS
+$BODY$
+	BEGIN
+		-- Phrases found in the previous content may be missing in the new one
+		IF EXISTS (SELECT FROM endpoints WHERE id=endpoint AND content_hash!=hash) THEN
+			DELETE FROM endpoints_phrases WHERE endpoint_id=endpoint;
+		END IF;
+		UPDATE endpoints SET content_hash=hash WHERE id=endpoint;
+		DELETE FROM endpoints_missing_phrases WHERE endpoint_id=endpoint AND content_hash!=hash;
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION create_crawled_endpoint(
+	"host" integer,
+	"endpoint" text,
+	"title" text,
+	"hash" text,
+	"page_language" text,
+	"page_status_code" integer,
+	"page_content_type" text,
+	"page_content_length" bigint,
+	"page_last_modified" timestamp with time zone,
+	"page_description" text,
+	"page_canonical_url" text,
+	"page_outbound_links" integer,
+	"page_simhash" bigint,
+	"page_truncated" boolean,
+	"page_final_url" text,
+	"page_schema_types" varchar[],
+	"page_structured_data" text
+)
+	RETURNS integer
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE endpoint_id integer;
+	BEGIN
+		SELECT create_endpoint_title(host, endpoint, title) INTO endpoint_id;
+		PERFORM set_endpoint_content_hash(endpoint_id, hash);
+		UPDATE endpoints SET
+			language=NULLIF(page_language, ''),
+			status_code=page_status_code,
+			content_type=NULLIF(page_content_type, ''),
+			content_length=page_content_length,
+			last_modified=page_last_modified,
+			description=NULLIF(page_description, ''),
+			canonical_url=NULLIF(page_canonical_url, ''),
+			outbound_links=page_outbound_links,
+			simhash=NULLIF(page_simhash, 0),
+			truncated=page_truncated,
+			final_url=NULLIF(page_final_url, ''),
+			schema_types=page_schema_types,
+			structured_data=NULLIF(page_structured_data, '')::jsonb,
+			crawled_at=CURRENT_TIMESTAMP
+		WHERE id=endpoint_id;
+		return endpoint_id;
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION create_endpoint_missing_phrase("host" integer, "endpoint" text, "search_phrase" text, "hash" text)
+	RETURNS void
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE 
+		last_phrase_id integer;
+		last_endpoint_id integer;
+	BEGIN
+		SELECT create_phrase(search_phrase) INTO last_phrase_id;
+		SELECT create_endpoint(host, endpoint) INTO last_endpoint_id;
+		PERFORM set_endpoint_content_hash(last_endpoint_id, hash);
+		INSERT INTO endpoints_missing_phrases (phrase_id, endpoint_id, content_hash)
+			VALUES (last_phrase_id, last_endpoint_id, hash)
+			ON CONFLICT (phrase_id, endpoint_id) DO UPDATE SET content_hash=EXCLUDED.content_hash;
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION set_endpoint_terms("host" integer, "endpoint" text, "endpoint_terms" text[])
+	RETURNS void
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE last_endpoint_id integer;
+	BEGIN
+		SELECT create_endpoint(host, endpoint) INTO last_endpoint_id;
+		DELETE FROM endpoints_terms WHERE endpoint_id=last_endpoint_id;
+		INSERT INTO terms (name) SELECT DISTINCT unnest(endpoint_terms) ON CONFLICT (name) DO NOTHING;
+		INSERT INTO endpoints_terms (term_id, endpoint_id)
+			SELECT id, last_endpoint_id FROM terms WHERE name=ANY(endpoint_terms);
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION set_endpoint_links("host" integer, "endpoint" text, "targets" text[], "anchors" text[])
+	RETURNS void
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE source_endpoint_id integer;
+	BEGIN
+		SELECT create_endpoint(host, endpoint) INTO source_endpoint_id;
+		DELETE FROM links WHERE source_id=source_endpoint_id;
+		FOR i IN 1..COALESCE(array_length(targets, 1), 0) LOOP
+			INSERT INTO links (source_id, target_id, anchor_text)
+				VALUES (source_endpoint_id, create_endpoint(host, targets[i]), anchors[i])
+				ON CONFLICT DO NOTHING;
+		END LOOP;
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION set_endpoint_external_links("host" integer, "endpoint" text, "urls" text[], "hosts" text[], "anchors" text[])
+	RETURNS void
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE source_endpoint_id integer;
+	BEGIN
+		SELECT create_endpoint(host, endpoint) INTO source_endpoint_id;
+		DELETE FROM external_links WHERE source_id=source_endpoint_id;
+		FOR i IN 1..COALESCE(array_length(urls, 1), 0) LOOP
+			INSERT INTO external_links (source_id, url, host, anchor_text)
+				VALUES (source_endpoint_id, urls[i], hosts[i], anchors[i])
+				ON CONFLICT DO NOTHING;
+		END LOOP;
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION host_hostname("host_name" text)
+	RETURNS text
+	LANGUAGE sql
+	IMMUTABLE
+AS
+$BODY$
+	SELECT lower(substring(host_name from '^[A-Za-z]+://([^/:]+)'));
+$BODY$;
+
+CREATE OR REPLACE FUNCTION create_linked_host("host_name" text)
+	RETURNS integer
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE linked_host_id integer;
+	BEGIN
+		SELECT id INTO linked_host_id FROM hosts
+			WHERE host_hostname(name)=host_hostname(host_name)
+			ORDER BY is_searchable DESC NULLS LAST, id
+			LIMIT 1;
+		IF NOT FOUND THEN
+			INSERT INTO hosts (name, is_searchable) VALUES (host_name, false) ON CONFLICT (name) DO NOTHING;
+			SELECT id INTO linked_host_id FROM hosts WHERE name=host_name;
+		END IF;
+		RETURN linked_host_id;
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION create_linked_endpoint("host_name" text, "endpoint" text)
+	RETURNS integer
+	LANGUAGE plpgsql
+AS
+$BODY$
+	BEGIN
+		RETURN create_endpoint(create_linked_host(host_name), endpoint);
+	END;
+$BODY$;
+
+CREATE OR REPLACE FUNCTION set_host_credential("host_name" text, "credential_kind" text, "credential_secret" text)
+	RETURNS integer
+	LANGUAGE plpgsql
+AS
+$BODY$
+	DECLARE
+		previous_credential_id integer;
+		new_credential_id integer;
+	BEGIN
+		SELECT credential_id INTO previous_credential_id FROM hosts WHERE name=host_name;
+		IF NOT FOUND THEN
+			RETURN NULL;
+		END IF;
+		INSERT INTO credentials (kind, secret) VALUES (credential_kind, credential_secret) RETURNING id INTO new_credential_id;
+		UPDATE hosts SET credential_id=new_credential_id WHERE name=host_name;
+		DELETE FROM credentials WHERE id=previous_credential_id;
+		RETURN new_credential_id;
+	END;
+$BODY$;
+
 INSERT INTO hosts (name, is_searchable) VALUES ('https://www.spacex.com/', true);
\ No newline at end of file
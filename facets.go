@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	FacetHost     = "host"
+	FacetSection  = "section"
+	FacetLanguage = "language"
+	FacetType     = "type"
+	// schema.org type of structured data, a page can have several
+	FacetSchema = "schema"
+)
+
+var facetNames = []string{FacetHost, FacetSection, FacetLanguage, FacetType, FacetSchema}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Returns top-level segment of the path, e.g. "/vehicles" for "/vehicles/falcon-9"
+func pathSection(path string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return "/" + segment
+}
+
+func facetValues(hit SearchHit, facet string) []string {
+	var value string
+	switch facet {
+	case FacetHost:
+		value = hit.page.Host
+	case FacetSection:
+		value = pathSection(hit.page.Path)
+	case FacetLanguage:
+		value = hit.page.Language
+	case FacetType:
+		value = hit.page.ContentType
+	case FacetSchema:
+		return hit.page.SchemaTypes
+	}
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// Reads comma separated facet names from "facets" param and filters from params named
+// after facets. Repeated filter matches any of its values, e.g. "host=a.com&host=b.com"
+func parseFacets(params url.Values) (facets []string, filters map[string][]string, err error) {
+	known := make(map[string]bool, len(facetNames))
+	for _, facet := range facetNames {
+		known[facet] = true
+	}
+
+	if value := params.Get("facets"); value != "" {
+		requested := make(map[string]bool)
+		for _, facet := range strings.Split(value, ",") {
+			facet = strings.TrimSpace(facet)
+			if !known[facet] {
+				return nil, nil, errors.New("Unknown facet " + facet + ", expected one of " + strings.Join(facetNames, ", "))
+			}
+			if !requested[facet] {
+				requested[facet] = true
+				facets = append(facets, facet)
+			}
+		}
+	}
+
+	filters = make(map[string][]string)
+	for _, facet := range facetNames {
+		if values := params[facet]; len(values) > 0 {
+			filters[facet] = values
+		}
+	}
+
+	return facets, filters, nil
+}
+
+func matchFacetFilters(hit SearchHit, filters map[string][]string, skipFacet string) bool {
+	for facet, values := range filters {
+		if facet == skipFacet {
+			continue
+		}
+		matched := false
+		for _, value := range facetValues(hit, facet) {
+			for _, filterValue := range values {
+				if strings.EqualFold(value, filterValue) {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns hits matching all filters and counts of requested facets. Facet is counted over hits
+// matching all filters except its own, so the other values of a filtered facet stay visible.
+// Similar hits are collapsed after filtering and before counting if collapse isn't nil, so counts
+// match the number of returned hits
+func applyFacets(hits []SearchHit, facets []string, filters map[string][]string, collapse func([]SearchHit) []SearchHit) ([]SearchHit, map[string][]FacetCount) {
+	filter := func(skipFacet string) []SearchHit {
+		filtered := make([]SearchHit, 0, len(hits))
+		for _, hit := range hits {
+			if matchFacetFilters(hit, filters, skipFacet) {
+				filtered = append(filtered, hit)
+			}
+		}
+		if collapse != nil {
+			return collapse(filtered)
+		}
+		return filtered
+	}
+
+	filtered := filter("")
+	if len(facets) == 0 {
+		return filtered, nil
+	}
+
+	counts := make(map[string][]FacetCount, len(facets))
+	for _, facet := range facets {
+		countByValue := make(map[string]int)
+		for _, hit := range filter(facet) {
+			for _, value := range facetValues(hit, facet) {
+				countByValue[value]++
+			}
+		}
+
+		facetCounts := make([]FacetCount, 0, len(countByValue))
+		for value, count := range countByValue {
+			facetCounts = append(facetCounts, FacetCount{Value: value, Count: count})
+		}
+		sort.Slice(facetCounts, func(i, j int) bool {
+			if facetCounts[i].Count != facetCounts[j].Count {
+				return facetCounts[i].Count > facetCounts[j].Count
+			}
+			return facetCounts[i].Value < facetCounts[j].Value
+		})
+		counts[facet] = facetCounts
+	}
+
+	return filtered, counts
+}
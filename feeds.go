@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/Moranilt/search-engine/parser"
+)
+
+// FetchedFeed is the feed with validators of the response, which make the next request of the feed conditional
+type FetchedFeed struct {
+	Feed         parser.Feed
+	ETag         string
+	LastModified string
+	// The feed hasn't changed since the response with the validators
+	NotModified bool
+}
+
+// FetchFeed downloads and parses the feed. The request is conditional when validators of the
+// previous response are given. Errors are *FetchError
+func (f *Fetcher) FetchFeed(feedURL string, etag string, lastModified string) (FetchedFeed, error) {
+	requestURL, err := url.Parse(feedURL)
+	if err != nil {
+		return FetchedFeed{}, f.fail(feedURL, FetchErrorOther, 0, err)
+	}
+	if err := f.checkRobots(context.Background(), feedURL, requestURL); err != nil {
+		return FetchedFeed{}, err
+	}
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	response, err := f.get(context.Background(), requestURL, header)
+	if err != nil {
+		return FetchedFeed{}, f.fail(feedURL, classifyError(err), 0, err)
+	}
+	defer response.Body.Close()
+	atomic.AddInt64(&f.Metrics.fetched, 1)
+
+	if response.StatusCode == http.StatusNotModified {
+		return FetchedFeed{ETag: etag, LastModified: lastModified, NotModified: true}, nil
+	}
+	if kind := statusErrorKind(response.StatusCode); kind != "" {
+		return FetchedFeed{}, f.fail(feedURL, kind, response.StatusCode, errors.New("Unexpected status "+response.Status))
+	}
+
+	fetched := FetchedFeed{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+	body := &bodyReader{reader: io.LimitReader(response.Body, f.MaxBodySize), hash: sha256.New()}
+	fetched.Feed, err = parser.ParseFeed(response.Header.Get("Content-Type"), body)
+	atomic.AddInt64(&f.Metrics.bytesRead, body.length)
+	if err != nil {
+		return FetchedFeed{}, f.fail(feedURL, FetchErrorOther, response.StatusCode, err)
+	}
+	return fetched, nil
+}
+
+// Returns paths of the feed entries which are pages of the host in its scope, links are relative to the feed
+func feedLinks(host Host, feedPath string, feed parser.Feed) []string {
+	var links []string
+	uniqueLinks := make(map[string]bool)
+	for _, entry := range feed.Entries {
+		target, scope := host.ClassifyLink(feedPath, entry.Link)
+		if scope != LinkInternal {
+			continue
+		}
+		if link := endpointPath(target); !uniqueLinks[link] {
+			uniqueLinks[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// Fetches the feed and indexes its entries which aren't endpoints of the host yet. Validators of
+// the response are stored after the entries, so entries aren't lost when indexing fails
+func (repository Repository) pollFeed(host Host, feed HostFeed) error {
+	hostURL, err := url.Parse(host.Name)
+	if err != nil {
+		return err
+	}
+	feedURL, err := hostURL.Parse(feed.Path)
+	if err != nil {
+		return err
+	}
+	fetched, err := repository.Fetcher.FetchFeed(feedURL.String(), feed.ETag, feed.LastModified)
+	if err != nil {
+		return err
+	}
+
+	if !fetched.NotModified {
+		feed.Title = fetched.Feed.Title
+		var newLinks []string
+		for _, link := range feedLinks(host, feed.Path, fetched.Feed) {
+			if !host.EndpointContains(repository.DB, link) {
+				newLinks = append(newLinks, link)
+			}
+		}
+		if len(newLinks) > 0 {
+			if err := repository.indexLinks(host, newLinks); err != nil {
+				return err
+			}
+			log.Printf("%d new entries of feed %s are indexed", len(newLinks), feedURL)
+		}
+	}
+
+	_, err = repository.DB.Exec(UpdateFeedPoll, feed.Id, feed.Title, fetched.ETag, fetched.LastModified)
+	return err
+}
+
+// Polls all feeds of the host. Feeds which can't be polled are logged and skipped
+func (repository Repository) PollHostFeeds(host Host) error {
+	feeds, err := host.GetFeeds(repository.DB)
+	if err != nil {
+		return err
+	}
+	for _, feed := range feeds {
+		if err := repository.pollFeed(host, feed); err != nil {
+			log.Printf("feed %s of %s isn't polled: %v", feed.Path, host.Name, err)
+		}
+	}
+	return nil
+}
+
+func (repository Repository) PollFeeds() error {
+	var hosts []Host
+	err := repository.DB.Select(&hosts, SelectHostsWithFeeds)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		if err := repository.PollHostFeeds(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Polls feeds of searchable hosts every interval until the process exits
+func (repository Repository) WatchFeeds(interval time.Duration) {
+	for {
+		if err := repository.PollFeeds(); err != nil {
+			log.Printf("feeds poll failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
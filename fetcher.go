@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Moranilt/search-engine/parser"
+)
+
+const (
+	DefaultMaxBodySize   = 10 << 20
+	DefaultMaxRedirects  = 10
+	DefaultMaxRetries    = 3
+	DefaultRetryBackoff  = time.Second
+	DefaultMaxRetryDelay = time.Minute
+	// Requests are finished before the time limit of the search
+	DefaultRequestTimeout = 20 * time.Second
+	DefaultMaxRetryTime   = 30 * time.Second
+)
+
+var (
+	ErrTooManyRedirects  = errors.New("Too many redirects")
+	ErrCrossHostRedirect = errors.New("Redirect to another host")
+)
+
+type FetchErrorKind string
+
+const (
+	FetchErrorTimeout    FetchErrorKind = "timeout"
+	FetchErrorDNS        FetchErrorKind = "dns"
+	FetchErrorConnection FetchErrorKind = "connection"
+	FetchErrorTLS        FetchErrorKind = "tls"
+	FetchErrorRedirect   FetchErrorKind = "redirect"
+	// Response with status 429 which wasn't successful after retries
+	FetchErrorRateLimited FetchErrorKind = "rate_limited"
+	FetchErrorClient      FetchErrorKind = "client_error"
+	FetchErrorServer      FetchErrorKind = "server_error"
+	// Missing page which is redirected to the main page of the host instead of 404 status
+	FetchErrorSoftNotFound FetchErrorKind = "soft_not_found"
+	// Page which robots.txt disallows for the crawler or host which robots.txt is unavailable
+	FetchErrorRobots FetchErrorKind = "robots"
+	FetchErrorOther  FetchErrorKind = "other"
+)
+
+// FetchError is the reason why the page wasn't fetched. StatusCode is 0 if there was no response
+type FetchError struct {
+	URL        string
+	Kind       FetchErrorKind
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.URL, e.Kind, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Returns kind of the error of the request which hasn't got a response
+func classifyError(err error) FetchErrorKind {
+	var dnsError *net.DNSError
+	var netError net.Error
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var certificateError x509.CertificateInvalidError
+	var recordHeaderError tls.RecordHeaderError
+	var opError *net.OpError
+	switch {
+	case errors.Is(err, ErrTooManyRedirects), errors.Is(err, ErrCrossHostRedirect):
+		return FetchErrorRedirect
+	case errors.Is(err, ErrDisallowedByRobots), errors.Is(err, ErrRobotsUnavailable):
+		return FetchErrorRobots
+	case errors.As(err, &dnsError):
+		return FetchErrorDNS
+	case errors.As(err, &netError) && netError.Timeout(), errors.Is(err, context.DeadlineExceeded):
+		return FetchErrorTimeout
+	case errors.As(err, &unknownAuthorityError), errors.As(err, &hostnameError),
+		errors.As(err, &certificateError), errors.As(err, &recordHeaderError):
+		return FetchErrorTLS
+	case errors.As(err, &opError):
+		return FetchErrorConnection
+	}
+	return FetchErrorOther
+}
+
+// Returns kind of the error of the response status, empty for successful responses
+func statusErrorKind(statusCode int) FetchErrorKind {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return ""
+	case statusCode == http.StatusTooManyRequests:
+		return FetchErrorRateLimited
+	case statusCode >= 500:
+		return FetchErrorServer
+	case statusCode >= 400:
+		return FetchErrorClient
+	case statusCode >= 300:
+		// Redirect which wasn't followed, e.g. without Location header
+		return FetchErrorRedirect
+	}
+	return FetchErrorOther
+}
+
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Reports whether the error means that the page is missing, so its status replaces the stored page.
+// Other errors, e.g. status 5xx after retries, may be temporary
+func isPermanentFailure(err error) bool {
+	var fetchError *FetchError
+	if !errors.As(err, &fetchError) {
+		return false
+	}
+	switch fetchError.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return fetchError.Kind == FetchErrorSoftNotFound
+}
+
+// Media types which are downloaded, "*" matches any part of the type, e.g. "application/*+xml"
+var DefaultAllowedContentTypes = []string{
+	"text/html",
+	"application/xhtml+xml",
+	"text/plain",
+	"application/pdf",
+	"application/xml",
+	"text/xml",
+	"application/*+xml",
+	"application/json",
+	"application/*+json",
+}
+
+// FetchMetrics counts responses of the fetcher
+type FetchMetrics struct {
+	Fetched int64 `json:"fetched"`
+	// Responses which weren't downloaded because of their content type
+	Rejected int64 `json:"rejected"`
+	// Responses which were larger than the maximum body size
+	Truncated int64 `json:"truncated"`
+	BytesRead int64 `json:"bytes_read"`
+	// Requests which were repeated after status 429 or 5xx
+	Retried int64 `json:"retried"`
+	// Pages which weren't fetched by kind of the error
+	Errors map[FetchErrorKind]int64 `json:"errors"`
+}
+
+// FetchCounters are FetchMetrics which are updated by concurrent fetches
+type FetchCounters struct {
+	fetched, rejected, truncated, bytesRead, retried int64
+
+	errorsMutex sync.Mutex
+	errors      map[FetchErrorKind]int64
+}
+
+func (c *FetchCounters) Snapshot() FetchMetrics {
+	c.errorsMutex.Lock()
+	defer c.errorsMutex.Unlock()
+	errorCounts := make(map[FetchErrorKind]int64, len(c.errors))
+	for kind, count := range c.errors {
+		errorCounts[kind] = count
+	}
+
+	return FetchMetrics{
+		Fetched:   atomic.LoadInt64(&c.fetched),
+		Rejected:  atomic.LoadInt64(&c.rejected),
+		Truncated: atomic.LoadInt64(&c.truncated),
+		BytesRead: atomic.LoadInt64(&c.bytesRead),
+		Retried:   atomic.LoadInt64(&c.retried),
+		Errors:    errorCounts,
+	}
+}
+
+func (c *FetchCounters) addError(kind FetchErrorKind) {
+	c.errorsMutex.Lock()
+	defer c.errorsMutex.Unlock()
+	if c.errors == nil {
+		c.errors = make(map[FetchErrorKind]int64)
+	}
+	c.errors[kind]++
+}
+
+// Fetcher downloads pages and extracts their documents while the body is read
+type Fetcher struct {
+	Client              *http.Client
+	MaxBodySize         int64
+	AllowedContentTypes []string
+	MaxRedirects        int
+	// Redirects to other hosts are errors unless they are followed. Hosts which differ
+	// only by "www." prefix are the same host
+	FollowCrossHostRedirects bool
+	// Responses with status 429 and 5xx are retried with delay which starts with RetryBackoff and
+	// doubles after every attempt. Retry-After header replaces the delay, which is at most MaxRetryDelay.
+	// The response is returned without retry when the next attempt would start after MaxRetryTime
+	MaxRetries    int
+	RetryBackoff  time.Duration
+	MaxRetryDelay time.Duration
+	MaxRetryTime  time.Duration
+	Identity      CrawlerIdentity
+	HostHeaders   HostHeaders
+	// Pages are checked by robots.txt of their hosts for the product token of Identity
+	Robots       *RobotsCache
+	IgnoreRobots bool
+	Credentials  *HostCredentials
+	Metrics      *FetchCounters
+}
+
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:              &http.Client{Timeout: DefaultRequestTimeout},
+		MaxBodySize:         DefaultMaxBodySize,
+		AllowedContentTypes: DefaultAllowedContentTypes,
+		MaxRedirects:        DefaultMaxRedirects,
+		MaxRetries:          DefaultMaxRetries,
+		RetryBackoff:        DefaultRetryBackoff,
+		MaxRetryDelay:       DefaultMaxRetryDelay,
+		MaxRetryTime:        DefaultMaxRetryTime,
+		Identity:            CrawlerIdentity{Name: DefaultCrawlerName},
+		Robots:              &RobotsCache{TTL: DefaultRobotsTTL},
+		Credentials:         &HostCredentials{},
+		Metrics:             &FetchCounters{},
+	}
+}
+
+type FetchedPage struct {
+	Document parser.Document
+	Metadata EndpointMetadata
+}
+
+// Reports whether the media type is allowed. Responses without type are allowed, it is detected by content
+func (f *Fetcher) AllowsContentType(mediaType string) bool {
+	if mediaType == "" {
+		return true
+	}
+	for _, pattern := range f.AllowedContentTypes {
+		if matched, _ := path.Match(pattern, mediaType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Fetch downloads the page. Body of not allowed type isn't read, larger bodies are truncated to
+// MaxBodySize. Both are returned with metadata and empty or partial document.
+// Errors are *FetchError. Body of the response with error status isn't read, the page is returned
+// with its metadata along with the error
+func (f *Fetcher) Fetch(pageURL string) (FetchedPage, error) {
+	return f.FetchContext(context.Background(), pageURL)
+}
+
+// FetchContext is Fetch which stops requests and retries when the context is done
+func (f *Fetcher) FetchContext(ctx context.Context, pageURL string) (FetchedPage, error) {
+	requestURL, err := url.Parse(pageURL)
+	if err != nil {
+		return FetchedPage{}, f.fail(pageURL, FetchErrorOther, 0, err)
+	}
+	if err := f.checkRobots(ctx, pageURL, requestURL); err != nil {
+		return FetchedPage{}, err
+	}
+	response, err := f.get(ctx, requestURL, nil)
+	if err != nil {
+		return FetchedPage{}, f.fail(pageURL, classifyError(err), 0, err)
+	}
+	defer response.Body.Close()
+	atomic.AddInt64(&f.Metrics.fetched, 1)
+
+	page := FetchedPage{Metadata: EndpointMetadata{
+		StatusCode:  response.StatusCode,
+		ContentType: responseContentType(response),
+	}}
+	if finalURL := response.Request.URL; finalURL.String() != requestURL.String() {
+		page.Metadata.FinalURL = finalURL.String()
+	}
+	if lastModified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		page.Metadata.LastModified = &lastModified
+	}
+
+	if kind := statusErrorKind(response.StatusCode); kind != "" {
+		return page, f.fail(pageURL, kind, response.StatusCode, errors.New("Unexpected status "+response.Status))
+	}
+	if isSoftNotFound(requestURL, response.Request.URL) {
+		return page, f.fail(pageURL, FetchErrorSoftNotFound, response.StatusCode, errors.New("Redirected to the main page"))
+	}
+
+	if !f.AllowsContentType(page.Metadata.ContentType) {
+		atomic.AddInt64(&f.Metrics.rejected, 1)
+		return page, nil
+	}
+
+	body := &bodyReader{reader: io.LimitReader(response.Body, f.MaxBodySize), hash: sha256.New()}
+	// Documents of unsupported types are stored without text, so they are not requested again
+	page.Document, _ = parser.ExtractReader(response.Header.Get("Content-Type"), body)
+	// The rest of the body which wasn't needed by extractor is read for the hash and length
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return FetchedPage{}, f.fail(pageURL, classifyError(err), 0, err)
+	}
+	atomic.AddInt64(&f.Metrics.bytesRead, body.length)
+
+	var next [1]byte
+	if n, _ := io.ReadFull(response.Body, next[:]); n > 0 {
+		page.Metadata.Truncated = true
+		atomic.AddInt64(&f.Metrics.truncated, 1)
+		log.Printf("%s: body is truncated to %d bytes", pageURL, f.MaxBodySize)
+	}
+
+	page.Metadata.ContentLength = body.length
+	page.Metadata.ContentHash = hex.EncodeToString(body.hash.Sum(nil))
+	page.Metadata.Description = page.Document.Description
+	page.Metadata.CanonicalURL = page.Document.CanonicalURL
+	page.Metadata.Language = pageLanguage(page.Document)
+	page.Metadata.OutboundLinks = parser.CountLinks(page.Document.Anchors)
+	if structured := page.Document.StructuredData; !structured.IsEmpty() {
+		page.Metadata.SchemaTypes = structured.Types
+		if page.Metadata.StructuredData, err = json.Marshal(structured); err != nil {
+			return FetchedPage{}, f.fail(pageURL, FetchErrorOther, 0, err)
+		}
+	}
+	return page, nil
+}
+
+// get requests the page with the header following redirects by the policy of the fetcher and
+// retrying responses with status 429 and 5xx until the context is done
+func (f *Fetcher) get(ctx context.Context, requestURL *url.URL, header http.Header) (*http.Response, error) {
+	client := *f.Client
+	client.CheckRedirect = f.checkRedirect
+	client.Transport = f.transport(f.Credentials)
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		response, err := client.Do(request)
+		if err != nil || !retryableStatus(response.StatusCode) || attempt >= f.MaxRetries {
+			return response, err
+		}
+		delay := f.retryDelay(attempt, response.Header.Get("Retry-After"))
+		if time.Since(start)+delay > f.MaxRetryTime {
+			return response, nil
+		}
+		response.Body.Close()
+
+		atomic.AddInt64(&f.Metrics.retried, 1)
+		log.Printf("%s: status %d, retrying in %s", requestURL, response.StatusCode, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// transport adds identity of the crawler, headers and credentials of hosts to requests of the client
+func (f *Fetcher) transport(hostCredentials *HostCredentials) http.RoundTripper {
+	base := f.Client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &identityTransport{base: base, identity: f.Identity, hostHeaders: f.HostHeaders, credentials: hostCredentials}
+}
+
+func (f *Fetcher) checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= f.MaxRedirects {
+		return ErrTooManyRedirects
+	}
+	if !f.FollowCrossHostRedirects && !sameHost(request.URL.Hostname(), via[0].URL.Hostname()) {
+		return ErrCrossHostRedirect
+	}
+	return nil
+}
+
+// Returns delay before the next attempt, retryAfter is number of seconds or HTTP date
+func (f *Fetcher) retryDelay(attempt int, retryAfter string) time.Duration {
+	delay := f.RetryBackoff << attempt
+	if seconds, err := strconv.Atoi(strings.TrimSpace(retryAfter)); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(retryAfter); err == nil {
+		delay = time.Until(date)
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > f.MaxRetryDelay {
+		delay = f.MaxRetryDelay
+	}
+	return delay
+}
+
+func (f *Fetcher) fail(pageURL string, kind FetchErrorKind, statusCode int, err error) *FetchError {
+	f.Metrics.addError(kind)
+	fetchError := &FetchError{URL: pageURL, Kind: kind, StatusCode: statusCode, Err: err}
+	log.Print(fetchError)
+	return fetchError
+}
+
+func sameHost(a string, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "www."), strings.TrimPrefix(b, "www."))
+}
+
+// Reports whether the page was redirected to the main page of the host, which sites do for missing pages
+func isSoftNotFound(requestURL *url.URL, finalURL *url.URL) bool {
+	isMainPage := func(pageURL *url.URL) bool {
+		return pageURL.Path == "" || pageURL.Path == "/"
+	}
+	return !isMainPage(requestURL) && isMainPage(finalURL) && finalURL.RawQuery == ""
+}
+
+// bodyReader hashes and counts bytes of the body while it is read
+type bodyReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	length int64
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.length += int64(n)
+	return n, err
+}
+
+// Returns media type of the response without parameters, e.g. "text/html"
+func responseContentType(response *http.Response) string {
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
@@ -6,4 +6,5 @@ require (
 	github.com/Moranilt/rou v1.1.1
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/lib/pq v1.10.6
+	golang.org/x/text v0.14.0
 )
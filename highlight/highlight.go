@@ -0,0 +1,253 @@
+package highlight
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Moranilt/search-engine/analyzer"
+)
+
+const (
+	DefaultPreTag    = "<em>"
+	DefaultPostTag   = "</em>"
+	DefaultSize      = 160
+	DefaultFragments = 2
+	ellipsis         = "…"
+)
+
+type Options struct {
+	// Tags around highlighted words. Text between tags is HTML escaped.
+	PreTag  string
+	PostTag string
+	// Returns plain text with character offsets of highlighted words instead of tags
+	Offsets bool
+	// Approximate length of a snippet in characters
+	Size int
+	// Maximum number of snippets per page
+	Fragments int
+}
+
+func DefaultOptions() Options {
+	return Options{PreTag: DefaultPreTag, PostTag: DefaultPostTag, Size: DefaultSize, Fragments: DefaultFragments}
+}
+
+// Highlight holds character offsets of a highlighted part of the snippet text
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type Snippet struct {
+	Text       string      `json:"text"`
+	Highlights []Highlight `json:"highlights,omitempty"`
+}
+
+// match is a byte range of the text which matches one of the terms
+type match struct {
+	start, end int
+	term       int
+}
+
+func findMatches(words []analyzer.Word, terms [][]string) []match {
+	var matches []match
+	for termIndex, term := range terms {
+		if len(term) == 0 {
+			continue
+		}
+		for i := 0; i+len(term) <= len(words); i++ {
+			found := true
+			for j, token := range term {
+				if words[i+j].Token != token {
+					found = false
+					break
+				}
+			}
+			if found {
+				matches = append(matches, match{start: words[i].Start, end: words[i+len(term)-1].End, term: termIndex})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].start < matches[j].start
+	})
+	return matches
+}
+
+type fragment struct {
+	start, end int
+	matches    []match
+	score      int
+}
+
+// Snippets builds fragments of text around the terms. Terms are values of query terms,
+// text and terms are analyzed with pageAnalyzer. If nothing matches the beginning
+// of the text is returned.
+func Snippets(text string, terms []string, pageAnalyzer analyzer.Analyzer, options Options) []Snippet {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if options.Size <= 0 {
+		options.Size = DefaultSize
+	}
+	if options.Fragments <= 0 {
+		options.Fragments = DefaultFragments
+	}
+
+	analyzedTerms := make([][]string, len(terms))
+	for i, term := range terms {
+		analyzedTerms[i] = pageAnalyzer.AnalyzeTokens(strings.Fields(term))
+	}
+	words := pageAnalyzer.Words(text)
+	matches := findMatches(words, analyzedTerms)
+
+	if len(matches) == 0 {
+		end := byteOffset(text, options.Size)
+		return []Snippet{format(text, fragment{start: 0, end: snapEnd(text, end)}, options)}
+	}
+
+	var candidates []fragment
+	for i, first := range matches {
+		start := snapStart(text, backwards(text, first.start, options.Size/4))
+		if start > first.start {
+			start = first.start
+		}
+		end := snapEnd(text, forward(text, start, options.Size))
+		if end < first.end {
+			end = first.end
+		}
+		candidate := fragment{start: start, end: end}
+
+		distinct := make(map[int]bool)
+		for _, m := range matches[i:] {
+			if m.end > end {
+				break
+			}
+			candidate.matches = append(candidate.matches, m)
+			distinct[m.term] = true
+		}
+		candidate.score = len(distinct)*len(matches) + len(candidate.matches)
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	var selected []fragment
+	for _, candidate := range candidates {
+		if len(selected) == options.Fragments {
+			break
+		}
+		overlaps := false
+		for _, other := range selected {
+			if candidate.start < other.end && other.start < candidate.end {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps && len(candidate.matches) > 0 {
+			selected = append(selected, candidate)
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].start < selected[j].start
+	})
+
+	snippets := make([]Snippet, len(selected))
+	for i, selectedFragment := range selected {
+		snippets[i] = format(text, selectedFragment, options)
+	}
+	return snippets
+}
+
+func format(text string, f fragment, options Options) Snippet {
+	var builder strings.Builder
+	var highlights []Highlight
+
+	write := func(part string) {
+		if options.Offsets {
+			builder.WriteString(part)
+		} else {
+			builder.WriteString(html.EscapeString(part))
+		}
+	}
+
+	if f.start > 0 {
+		builder.WriteString(ellipsis)
+	}
+
+	position := f.start
+	for _, m := range f.matches {
+		if m.start < position {
+			continue
+		}
+		write(text[position:m.start])
+		if options.Offsets {
+			start := utf8.RuneCountInString(builder.String())
+			builder.WriteString(text[m.start:m.end])
+			highlights = append(highlights, Highlight{Start: start, End: start + utf8.RuneCountInString(text[m.start:m.end])})
+		} else {
+			builder.WriteString(options.PreTag)
+			write(text[m.start:m.end])
+			builder.WriteString(options.PostTag)
+		}
+		position = m.end
+	}
+	write(text[position:f.end])
+
+	if f.end < len(text) {
+		builder.WriteString(ellipsis)
+	}
+
+	return Snippet{Text: builder.String(), Highlights: highlights}
+}
+
+// byteOffset returns the byte offset after count characters of the text
+func byteOffset(text string, count int) int {
+	for index := range text {
+		if count == 0 {
+			return index
+		}
+		count--
+	}
+	return len(text)
+}
+
+func forward(text string, from int, count int) int {
+	return from + byteOffset(text[from:], count)
+}
+
+func backwards(text string, from int, count int) int {
+	for from > 0 && count > 0 {
+		_, size := utf8.DecodeLastRuneInString(text[:from])
+		from -= size
+		count--
+	}
+	return from
+}
+
+// snapStart moves offset forward to the beginning of a word
+func snapStart(text string, offset int) int {
+	if offset == 0 {
+		return 0
+	}
+	if space := strings.IndexByte(text[offset:], ' '); space != -1 && text[offset-1] != ' ' {
+		return offset + space + 1
+	}
+	return offset
+}
+
+// snapEnd moves offset backwards to the end of a word
+func snapEnd(text string, offset int) int {
+	if offset >= len(text) {
+		return len(text)
+	}
+	if space := strings.LastIndexByte(text[:offset], ' '); space != -1 && text[offset] != ' ' {
+		return space
+	}
+	return offset
+}
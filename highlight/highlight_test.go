@@ -0,0 +1,85 @@
+package highlight
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Moranilt/search-engine/analyzer"
+)
+
+var english = analyzer.New().WithLanguage("en")
+
+func TestSnippets(t *testing.T) {
+	t.Run("highlight words and phrases", func(t *testing.T) {
+		text := "SpaceX launches Falcon 9. The next launch window opens on Monday."
+		got := Snippets(text, []string{"falcon", "launch window"}, english, DefaultOptions())
+		want := []Snippet{{Text: "SpaceX launches <em>Falcon</em> 9. The next <em>launch window</em> opens on Monday."}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("stemmed words", func(t *testing.T) {
+		text := "Dragon was launched on Falcon"
+		got := Snippets(text, []string{"launch"}, english, DefaultOptions())
+		want := []Snippet{{Text: "Dragon was <em>launched</em> on Falcon"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("custom tags and escaping", func(t *testing.T) {
+		options := DefaultOptions()
+		options.PreTag, options.PostTag = "[", "]"
+		got := Snippets("R&D of <Starship>", []string{"starship"}, english, options)
+		want := []Snippet{{Text: "R&amp;D of &lt;[Starship]&gt;"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("offsets", func(t *testing.T) {
+		options := DefaultOptions()
+		options.Offsets = true
+		got := Snippets("Запуск ракеты <Falcon>", []string{"falcon", "ракеты"}, analyzer.New(), options)
+		want := []Snippet{{
+			Text:       "Запуск ракеты <Falcon>",
+			Highlights: []Highlight{{Start: 7, End: 13}, {Start: 15, End: 21}},
+		}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("fragments of long text", func(t *testing.T) {
+		options := DefaultOptions()
+		options.Size = 30
+		text := "Falcon 9 is a reusable, two-stage rocket. It carries people and payloads. " +
+			"Lots of unrelated words are written here to make the text long enough. " +
+			"Dragon spacecraft is launched on top of Falcon 9 from the Florida coast."
+		got := Snippets(text, []string{"dragon", "falcon"}, english, options)
+		want := []Snippet{
+			{Text: "<em>Falcon</em> 9 is a reusable,…"},
+			{Text: "…<em>Dragon</em> spacecraft is launched…"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("beginning of the text without matches", func(t *testing.T) {
+		options := DefaultOptions()
+		options.Size = 20
+		got := Snippets("Making life multiplanetary since 2002", []string{"mars"}, english, options)
+		want := []Snippet{{Text: "Making life…"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("empty text", func(t *testing.T) {
+		if got := Snippets(" ", []string{"mars"}, english, DefaultOptions()); got != nil {
+			t.Errorf("got %v, want nil", got)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const DefaultCrawlerName = "SearchEngineBot/1.0"
+
+// CrawlerIdentity is sent with every request, so owners of sites can recognize and contact the crawler
+type CrawlerIdentity struct {
+	// Product token with version, e.g. "SearchEngineBot/1.0"
+	Name string
+	// Page which describes the crawler, added to the User-Agent
+	ContactURL string
+	// E-mail of the operator, sent in the From header
+	From string
+}
+
+// UserAgent returns e.g. "SearchEngineBot/1.0 (+https://example.com/bot)"
+func (i CrawlerIdentity) UserAgent() string {
+	if i.ContactURL == "" {
+		return i.Name
+	}
+	return i.Name + " (+" + i.ContactURL + ")"
+}
+
+// Token returns the product token which robots.txt addresses, e.g. "SearchEngineBot"
+func (i CrawlerIdentity) Token() string {
+	token, _, _ := strings.Cut(i.Name, "/")
+	return token
+}
+
+// HostHeaders are headers sent only to the host, e.g. cookies of an intranet site. They override
+// headers of the crawler identity. Keys are lowercase host names without port
+type HostHeaders map[string]http.Header
+
+// LoadHostHeaders reads headers by host from JSON file, e.g. {"intranet.local": {"Cookie": "session=1"}}
+func LoadHostHeaders(path string) (HostHeaders, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var headersByHost map[string]map[string]string
+	if err := json.Unmarshal(content, &headersByHost); err != nil {
+		return nil, err
+	}
+
+	hostHeaders := make(HostHeaders, len(headersByHost))
+	for host, headers := range headersByHost {
+		header := make(http.Header, len(headers))
+		for name, value := range headers {
+			header.Set(name, value)
+		}
+		hostHeaders[strings.ToLower(host)] = header
+	}
+	return hostHeaders, nil
+}
+
+// identityTransport adds headers of the crawler, headers and credential of the host to every
+// request, including redirects. Headers of a host are added by the host of each request, so they
+// aren't sent to other hosts after redirect
+type identityTransport struct {
+	base        http.RoundTripper
+	identity    CrawlerIdentity
+	hostHeaders HostHeaders
+	credentials *HostCredentials
+}
+
+func (t *identityTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Header.Set("User-Agent", t.identity.UserAgent())
+	if t.identity.From != "" {
+		request.Header.Set("From", t.identity.From)
+	}
+	for name, values := range t.hostHeaders[strings.ToLower(request.URL.Hostname())] {
+		request.Header[name] = values
+	}
+
+	response, session, err := t.roundTripWithCredential(request)
+	// Expired login session is started again and the request is repeated once, requests with
+	// body aren't repeated because the body was already read
+	if err == nil && session != nil && request.Body == nil && session.loginRequired(response) {
+		if err := session.restart(session.expired); err != nil {
+			return response, nil
+		}
+		response.Body.Close()
+		response, _, err = t.roundTripWithCredential(request)
+	}
+	return response, err
+}
+
+type sentSession struct {
+	*loginSession
+	// Cookies which were sent with the request
+	expired http.CookieJar
+}
+
+func (t *identityTransport) roundTripWithCredential(request *http.Request) (*http.Response, *sentSession, error) {
+	request = request.Clone(request.Context())
+	session, jar := t.credentials.apply(request)
+	response, err := t.base.RoundTrip(request)
+	if err != nil || session == nil {
+		return response, nil, err
+	}
+	jar.SetCookies(request.URL, response.Cookies())
+	return response, &sentSession{loginSession: session, expired: jar}, nil
+}
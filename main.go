@@ -1,154 +1,659 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Moranilt/rou"
+	"github.com/Moranilt/search-engine/analyzer"
+	"github.com/Moranilt/search-engine/autocomplete"
+	"github.com/Moranilt/search-engine/credentials"
+	"github.com/Moranilt/search-engine/highlight"
 	"github.com/Moranilt/search-engine/parser"
+	"github.com/Moranilt/search-engine/query"
+	"github.com/Moranilt/search-engine/simhash"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const (
-	BodyIsNotValid   = "Request body is not valid"
-	MethodNotAllowed = "Method not allowed"
+	BodyIsNotValid          = "Request body is not valid"
+	MethodNotAllowed        = "Method not allowed"
+	CredentialsKeyIsMissing = "Credentials key is not configured"
+	FeedIsNotOnHost         = "Feed must be on the host"
+)
+
+const (
+	DefaultSearchLimit = 10
+	MaxSearchLimit     = 100
+	// Time limit of the search including requests of pages which weren't checked yet
+	SearchTimeout = 60 * time.Second
+	// Number of pages of a host which are requested at once by the search or crawl
+	MaxHostRequests = 4
 )
 
 type LinksWithTitle struct {
-	Title string `json:"title"`
-	Link  string `json:"link"`
+	Title    string              `json:"title"`
+	Link     string              `json:"link"`
+	Snippets []highlight.Snippet `json:"snippets,omitempty"`
+}
+
+type PageSearchResult struct {
+	LinksWithTitle
+	EndpointMetadata
+	Anchors []parser.Anchor
+	// Extracted text and its unique normalized tokens
+	Text  string
+	Terms []string
+	Found map[string]bool
+}
+
+func uniqueTerms(tokens []string) []string {
+	var terms []string
+	unique := make(map[string]bool)
+	for _, token := range tokens {
+		if !unique[token] {
+			unique[token] = true
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// Returns language declared by the document, e.g. in <html lang>, or detected by its text
+func pageLanguage(document parser.Document) string {
+	if document.Language != "" {
+		return analyzer.LanguageCode(document.Language)
+	}
+	return analyzer.DetectLanguage(document.Text)
 }
 
-func getLinkWithTitleBySearch(requestLink string, hostLink string, searchPhrase string, linkChan chan<- LinksWithTitle, errChan chan<- error) {
-	requestURL := &url.URL{Host: hostLink[8 : len(hostLink)-1], Scheme: "https", Path: requestLink}
+// Builds result of the crawled page from its document and normalized tokens of the text
+func newPageSearchResult(link string, page FetchedPage, tokens []string) PageSearchResult {
+	result := PageSearchResult{
+		LinksWithTitle:   LinksWithTitle{Link: link, Title: page.Document.Title},
+		EndpointMetadata: page.Metadata,
+		Anchors:          page.Document.Anchors,
+		Text:             page.Document.Text,
+		Terms:            uniqueTerms(tokens),
+		Found:            make(map[string]bool),
+	}
+	result.SimHash = int64(simhash.Fingerprint(tokens))
+	return result
+}
 
-	response, err := http.Get(requestURL.String())
+func getLinkWithTitleBySearch(ctx context.Context, fetcher *Fetcher, requestLink string, hostLink string, searchPhrases []string, textAnalyzer analyzer.Analyzer, linkChan chan<- PageSearchResult, errChan chan<- error) {
+	requestURL, err := endpointURL(hostLink, requestLink)
 	if err != nil {
 		errChan <- err
 		return
 	}
-	defer response.Body.Close()
-	bytes, _ := io.ReadAll(response.Body)
-	if strings.Contains(string(bytes), searchPhrase) {
-		linkChan <- LinksWithTitle{Title: parser.ExtractTitle(bytes), Link: requestLink}
-	} else {
-		linkChan <- LinksWithTitle{}
+
+	// Missing page is stored with its status without text, so it isn't found and isn't requested
+	// again. Stored page isn't replaced by temporary errors
+	page, err := fetcher.FetchContext(ctx, requestURL.String())
+	if err != nil && !isPermanentFailure(err) {
+		errChan <- err
+		return
+	}
+	normalizedTokens := textAnalyzer.Tokenize(page.Document.Text)
+	result := newPageSearchResult(requestLink, page, normalizedTokens)
+	pageAnalyzer := textAnalyzer.WithLanguage(result.Language)
+	tokens := pageAnalyzer.AnalyzeTokens(normalizedTokens)
+	for _, searchPhrase := range searchPhrases {
+		result.Found[searchPhrase] = query.ContainsTerm(tokens, searchPhrase, pageAnalyzer)
+	}
+	linkChan <- result
+}
+
+// Returns links through the channel which is closed after them
+func linksQueue(links []string) <-chan string {
+	queue := make(chan string, len(links))
+	for _, link := range links {
+		queue <- link
 	}
+	close(queue)
+	return queue
 }
 
-func requestAndSearch(searchPhrase string, hostLink string, clearLinks []string) ([]LinksWithTitle, error) {
-	errorChan := make(chan error)
-	linkChan := make(chan LinksWithTitle)
+// Requests the pages of the host and checks them for the search phrases. Pages which were checked
+// before the time limit are returned along with the error
+func requestAndSearch(fetcher *Fetcher, searchPhrases []string, hostLink string, clearLinks []string, textAnalyzer analyzer.Analyzer) ([]PageSearchResult, error) {
+	// Channels are buffered, so requests which finish after the time limit don't block
+	errorChan := make(chan error, len(clearLinks))
+	linkChan := make(chan PageSearchResult, len(clearLinks))
+	ctx, cancel := context.WithTimeout(context.Background(), SearchTimeout)
+	defer cancel()
 
-	for _, clearLink := range clearLinks {
-		go getLinkWithTitleBySearch(clearLink, hostLink, searchPhrase, linkChan, errorChan)
+	queue := linksQueue(clearLinks)
+	for i := 0; i < MaxHostRequests && i < len(clearLinks); i++ {
+		go func() {
+			for clearLink := range queue {
+				getLinkWithTitleBySearch(ctx, fetcher, clearLink, hostLink, searchPhrases, textAnalyzer, linkChan, errorChan)
+			}
+		}()
 	}
 
-	var result []LinksWithTitle
+	var result []PageSearchResult
 	doneJobs := 0
 
 	for {
 		select {
-		case err := <-errorChan:
-			return nil, err
+		case <-errorChan:
+			// The page is skipped, the error is logged and counted by the fetcher
+			doneJobs++
 		case link := <-linkChan:
-			if len(link.Link) > 0 {
-				result = append(result, link)
-			}
+			result = append(result, link)
 			doneJobs++
-			if doneJobs == len(clearLinks) {
-				return result, nil
+		case <-ctx.Done():
+			return result, errors.New("Time limit exceed")
+		}
+		if doneJobs == len(clearLinks) {
+			return result, nil
+		}
+	}
+}
+
+// Returns text which describes the target of the link: its content and title attribute
+func anchorText(anchor parser.Anchor) string {
+	if strings.Contains(strings.ToLower(anchor.Text), strings.ToLower(anchor.Title)) {
+		return anchor.Text
+	}
+	return strings.TrimSpace(anchor.Text + " " + anchor.Title)
+}
+
+// Stores links of the crawled page by the scope of the host: links to other endpoints of the host,
+// endpoints of other hosts in the scope and external links out of the scope
+func storePageLinks(host Host, page PageSearchResult) error {
+	var targets, anchors, externalAnchors []string
+	var externalTargets []*url.URL
+	for _, anchor := range page.Anchors {
+		target, scope := host.ClassifyLink(page.Link, anchor.Href)
+		switch scope {
+		case LinkInternal:
+			targets = append(targets, endpointPath(target))
+			anchors = append(anchors, anchorText(anchor))
+		case LinkFollowed:
+			if err := host.StoreFollowedLink(target); err != nil {
+				return err
 			}
-		case <-time.After(time.Second * 60):
-			return nil, errors.New("Time limit exceed")
+		case LinkExternal:
+			externalTargets = append(externalTargets, target)
+			externalAnchors = append(externalAnchors, anchorText(anchor))
 		}
 	}
+	if err := host.StoreEndpointLinks(page.Link, targets, anchors); err != nil {
+		return err
+	}
+	return host.StoreExternalLinks(page.Link, externalTargets, externalAnchors)
+}
+
+// Stores the crawled page as endpoint of the host with its terms, content and links
+func storePage(host Host, page PageSearchResult) error {
+	if err := host.NewEndpoint(page.Link, page.Title, page.EndpointMetadata); err != nil {
+		return err
+	}
+	if err := host.StoreEndpointTerms(page.Link, page.Terms); err != nil {
+		return err
+	}
+	if err := host.StoreEndpointContent(page.Link, page.Text); err != nil {
+		return err
+	}
+	return storePageLinks(host, page)
+}
+
+// Stores pages which were requested by the search with the cached search phrases. Found terms
+// are marked in found by paths of the pages
+func (repository Repository) storeCheckedPages(host Host, pages []PageSearchResult, found map[string]map[string]bool) error {
+	if err := host.Begin(repository.DB); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := storePage(host, page); err != nil {
+			host.Rollback()
+			return err
+		}
+		for term, pageContainsTerm := range page.Found {
+			var err error
+			if pageContainsTerm {
+				err = host.StoreEndpointByPhrase(page.Link, term, page.Title)
+			} else {
+				err = host.StoreEndpointWithoutPhrase(page.Link, term, page.ContentHash)
+			}
+			if err != nil {
+				host.Rollback()
+				return err
+			}
+		}
+	}
+	if err := host.Commit(); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		for term, pageContainsTerm := range page.Found {
+			if pageContainsTerm {
+				found[term][page.Link] = true
+			}
+		}
+	}
+	return nil
 }
 
 type SearchResultLinksByHost struct {
-	Link  string
-	Links []LinksWithTitle
+	Link string
+	Hits []SearchHit
 }
 
-func (repository Repository) searchPhraseByHost(host Host, searchPhrase string, result chan<- SearchResultLinksByHost, errorChan chan<- error) {
+// Ranks a matched page: every positive term found in the content or in texts of links
+// to the page adds 1, in the title - 2. Authority of the page is added with authorityWeight
+func rankPage(page query.Page, positiveTerms []string, found map[string]map[string]bool, authority float64, authorityWeight float64) float64 {
+	score := authority * authorityWeight
+	for _, term := range positiveTerms {
+		if found[term][page.Path] {
+			score++
+		}
+		if page.AnchorsContain(term) {
+			score++
+		}
+		if query.ContainsTerm(page.TitleTokens, term, page.Analyzer) {
+			score += 2
+		}
+	}
+	return score
+}
 
-	var searchResult []LinksWithTitle
+// Evaluates query against endpoints of the host. Content terms are looked up in the phrases
+// cache, field operators are matched against the endpoint itself. Only endpoints for which the
+// result depends on unknown terms are requested and the cache is updated for all of the terms.
+func (repository Repository) searchQueryByHost(host Host, searchQuery query.Node, result chan<- SearchResultLinksByHost, errorChan chan<- error) {
+	terms := query.Terms(searchQuery)
+	found := make(map[string]map[string]bool)
+	unknown := make(map[string]map[string]bool)
 
-	eWithSearchPhrase := host.GetEndpointsWithSearchPhrase(repository.DB, searchPhrase)
-	eWithoutSearchPhrase := host.GetEndpointsWithoutSearchPhrase(repository.DB, searchPhrase)
+	for _, term := range terms {
+		found[term] = make(map[string]bool)
+		unknown[term] = make(map[string]bool)
+		for _, endpoint := range host.GetEndpointsWithSearchPhrase(repository.DB, term) {
+			found[term][endpoint.Path] = true
+		}
+		for _, endpoint := range host.GetEndpointsWithoutSearchPhrase(repository.DB, term) {
+			unknown[term][endpoint] = true
+		}
+	}
 
-	for _, endpoint := range eWithSearchPhrase {
-		searchResult = append(searchResult, LinksWithTitle{Title: endpoint.Title, Link: endpoint.Path})
+	var pages []query.Page
+	anchors := host.GetIncomingAnchors(repository.DB)
+	authority := make(map[string]float64)
+	fingerprints := make(map[string]uint64)
+	structuredData := make(map[string]JSONData)
+	uniqueLinks := make(map[string]bool)
+	// Endpoints which are known only by links are found by texts of the links, but they aren't
+	// requested by the search. They are crawled by the queue, see CrawlLinkedEndpoints
+	linkedOnly := make(map[string]bool)
+	for _, endpoint := range host.GetEndpoints(repository.DB) {
+		// Endpoints which responded with error status aren't found, e.g. by texts of links to them.
+		// Status of endpoints which are known only by links is 0
+		if !uniqueLinks[endpoint.Path] && endpoint.StatusCode < http.StatusMultipleChoices {
+			uniqueLinks[endpoint.Path] = true
+			linkedOnly[endpoint.Path] = endpoint.IsLinkedOnly()
+			authority[endpoint.Path] = endpoint.Authority
+			fingerprints[endpoint.Path] = uint64(endpoint.SimHash)
+			structuredData[endpoint.Path] = endpoint.StructuredData
+			pageAnalyzer := repository.Analyzer.WithLanguage(endpoint.Language)
+			var anchorTokens [][]string
+			for _, anchor := range anchors[endpoint.Path] {
+				anchorTokens = append(anchorTokens, pageAnalyzer.Analyze(anchor))
+			}
+			pages = append(pages, query.Page{
+				Host:         host.Hostname(),
+				Path:         endpoint.Path,
+				Title:        endpoint.Title,
+				TitleTokens:  pageAnalyzer.Analyze(endpoint.Title),
+				AnchorTokens: anchorTokens,
+				Analyzer:     pageAnalyzer,
+				Language:     endpoint.Language,
+				ContentType:  endpoint.ContentType,
+				SchemaTypes:  endpoint.SchemaTypes,
+			})
+		}
 	}
 
-	if len(eWithoutSearchPhrase) > 0 {
-		haveSearchPhrase, err := requestAndSearch(searchPhrase, host.Name, eWithoutSearchPhrase)
-		if err != nil {
+	var uncheckedEndpoints []string
+	for _, page := range pages {
+		match := searchQuery.Resolve(func(term query.Term) query.Match {
+			switch {
+			case term.Field != "":
+				if term.MatchField(page) {
+					return query.Matched
+				}
+				return query.NotMatched
+			case found[term.Value][page.Path], page.AnchorsContain(term.Value):
+				return query.Matched
+			case unknown[term.Value][page.Path] && !linkedOnly[page.Path]:
+				return query.Unknown
+			}
+			return query.NotMatched
+		})
+		if match == query.Unknown {
+			uncheckedEndpoints = append(uncheckedEndpoints, page.Path)
+		}
+	}
+
+	if len(uncheckedEndpoints) > 0 {
+		checkedPages, err := requestAndSearch(repository.Fetcher, terms, host.Name, uncheckedEndpoints, repository.Analyzer)
+		// Pages which were checked before the time limit are stored, so the next search doesn't request them again
+		if err := repository.storeCheckedPages(host, checkedPages, found); err != nil {
 			errorChan <- err
 			return
 		}
-		host.MustBegin(repository.DB)
-		for _, endpoint := range haveSearchPhrase {
-			host.StoreEndpointByPhrase(endpoint.Link, searchPhrase, endpoint.Title)
-		}
-		host.Commit()
-
 		if err != nil {
 			errorChan <- err
 			return
 		}
-		searchResult = append(searchResult, haveSearchPhrase...)
 	}
 
-	result <- SearchResultLinksByHost{Link: host.Name, Links: searchResult}
+	var hits []SearchHit
+	positiveTerms := query.PositiveTerms(searchQuery)
+	for _, page := range pages {
+		matches := searchQuery.Eval(func(term query.Term) bool {
+			if term.Field != "" {
+				return term.MatchField(page)
+			}
+			return found[term.Value][page.Path] || page.AnchorsContain(term.Value)
+		})
+		if matches {
+			hits = append(hits, SearchHit{
+				Host:           host.Name,
+				LinksWithTitle: LinksWithTitle{Title: page.Title, Link: page.Path},
+				Score:          rankPage(page, positiveTerms, found, authority[page.Path], repository.AuthorityWeight),
+				host:           host,
+				page:           page,
+				simhash:        fingerprints[page.Path],
+				structuredData: structuredData[page.Path],
+			})
+		}
+	}
+
+	result <- SearchResultLinksByHost{Link: host.Name, Hits: hits}
+}
+
+// Adds snippets to the hits from stored text of their endpoints
+func (repository Repository) addSnippets(hits []SearchHit, searchQuery query.Node, highlightOptions highlight.Options) {
+	hitsByHost := make(map[int][]int)
+	for i, hit := range hits {
+		hitsByHost[hit.host.Id] = append(hitsByHost[hit.host.Id], i)
+	}
+
+	highlightTerms := query.PositiveTerms(searchQuery)
+	for _, indexes := range hitsByHost {
+		host := hits[indexes[0]].host
+		paths := make([]string, len(indexes))
+		for i, index := range indexes {
+			paths[i] = hits[index].Link
+		}
+
+		contents := host.GetEndpointsContent(repository.DB, paths)
+		for _, index := range indexes {
+			hit := &hits[index]
+			hit.Snippets = highlight.Snippets(contents[hit.Link], highlightTerms, hit.page.Analyzer, highlightOptions)
+		}
+	}
+}
+
+// Adds image, description, author and date from structured data of their endpoints to the hits
+func addStructuredSummaries(hits []SearchHit) {
+	for i := range hits {
+		if len(hits[i].structuredData) == 0 {
+			continue
+		}
+		var data parser.StructuredData
+		if err := json.Unmarshal(hits[i].structuredData, &data); err != nil {
+			continue
+		}
+		if summary := data.Summary(); summary != (parser.StructuredSummary{}) {
+			hits[i].Structured = &summary
+		}
+	}
+}
+
+// Reads "limit" and "offset" params. Limit is capped with MaxSearchLimit.
+func parsePagination(params url.Values) (limit int, offset int, err error) {
+	limit = DefaultSearchLimit
+	if value := params.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("Limit must be a positive number")
+		}
+		if limit > MaxSearchLimit {
+			limit = MaxSearchLimit
+		}
+	}
+
+	if value := params.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Offset must be a non-negative number")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// Sorts hits by score, then by host and link
+func sortHits(hits []SearchHit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Host != hits[j].Host {
+			return hits[i].Host < hits[j].Host
+		}
+		return hits[i].Link < hits[j].Link
+	})
+}
+
+// Sorts hits by score and returns the requested page of them
+func paginateHits(hits []SearchHit, limit int, offset int) []SearchHit {
+	sortHits(hits)
+
+	if offset >= len(hits) {
+		return []SearchHit{}
+	}
+	end := offset + limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[offset:end]
+}
+
+// Leaves the best hit of every group of pages with similar content. Pages are similar if their
+// fingerprints differ in at most maxDistance bits. Number of hidden pages is kept in Similar
+func collapseSimilar(hits []SearchHit, maxDistance int) []SearchHit {
+	sortHits(hits)
+
+	var representatives []SearchHit
+	for _, hit := range hits {
+		duplicate := false
+		if hit.simhash != 0 {
+			for i := range representatives {
+				if representatives[i].simhash != 0 && simhash.Distance(hit.simhash, representatives[i].simhash) <= maxDistance {
+					representatives[i].Similar++
+					duplicate = true
+					break
+				}
+			}
+		}
+		if !duplicate {
+			representatives = append(representatives, hit)
+		}
+	}
+	return representatives
+}
+
+// Reads snippet options from "snippets" (number of fragments, 0 disables snippets),
+// "highlight" ("tags" or "offsets"), "pre_tag" and "post_tag" params
+func parseHighlightOptions(params url.Values) (highlight.Options, error) {
+	options := highlight.DefaultOptions()
+
+	if value := params.Get("snippets"); value != "" {
+		fragments, err := strconv.Atoi(value)
+		if err != nil || fragments < 0 {
+			return options, errors.New("Snippets must be a non-negative number")
+		}
+		options.Fragments = fragments
+	}
+
+	switch params.Get("highlight") {
+	case "", "tags":
+	case "offsets":
+		options.Offsets = true
+	default:
+		return options, errors.New("Highlight must be \"tags\" or \"offsets\"")
+	}
+
+	if params.Has("pre_tag") {
+		options.PreTag = params.Get("pre_tag")
+	}
+	if params.Has("post_tag") {
+		options.PostTag = params.Get("post_tag")
+	}
+
+	return options, nil
 }
 
 func (repository Repository) SearchHandler(request *rou.Context) {
-	searchPhrase := request.Params().Get("text")
-	if searchPhrase == "" {
-		request.ErrorJSONResponse(http.StatusBadRequest, "Nothing to find")
+	searchQuery, err := query.Parse(request.Params().Get("text"))
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+	searchQuery = query.Analyze(searchQuery, repository.Analyzer)
+	if searchQuery == nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, query.ErrEmptyQuery.Error())
+		return
+	}
+
+	highlightOptions, err := parseHighlightOptions(request.Params())
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
 		return
 	}
-	resultLinks := make(chan SearchResultLinksByHost)
-	errorChan := make(chan error)
 
-	var pageLinks []ResultSearch
+	limit, offset, err := parsePagination(request.Params())
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	facets, facetFilters, err := parseFacets(request.Params())
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
 
+	collapse := true
+	if value := request.Params().Get("collapse"); value != "" {
+		collapse, err = strconv.ParseBool(value)
+		if err != nil {
+			request.ErrorJSONResponse(http.StatusBadRequest, "Collapse must be true or false")
+			return
+		}
+	}
+
+	repository.DB.Exec(CountPhraseSearch, query.String(searchQuery))
+
+	response := SearchResponse{Limit: limit, Offset: offset}
+	dictionary := repository.Vocabulary.Dictionary()
+	if dictionary.Len() > 0 {
+		if suggestion := query.String(query.Correct(searchQuery, dictionary.Correct)); suggestion != query.String(searchQuery) {
+			response.Suggestion = suggestion
+			searchQuery = query.Fuzzy(searchQuery, dictionary.Correct)
+		}
+	}
+	// Hosts which are known only by links aren't searched until they are activated
 	var hosts []Host
-	repository.DB.Select(&hosts, SelectAllFromHosts)
+	repository.DB.Select(&hosts, SelectSearchableHosts)
+
+	resultLinks := make(chan SearchResultLinksByHost, len(hosts))
+	errorChan := make(chan error, len(hosts))
 
 	for _, link := range hosts {
-		go repository.searchPhraseByHost(link, searchPhrase, resultLinks, errorChan)
+		if query.Sites(searchQuery, link.Hostname()) == query.NotMatched {
+			resultLinks <- SearchResultLinksByHost{Link: link.Name}
+			continue
+		}
+		go repository.searchQueryByHost(link, searchQuery, resultLinks, errorChan)
 	}
 
-	done := 0
-	for {
+	var hits []SearchHit
+	timeout := time.After(SearchTimeout)
+	for done := 0; done < len(hosts); {
 		select {
 		case err := <-errorChan:
 			request.ErrorJSONResponse(http.StatusBadGateway, fmt.Sprint(err))
 			return
 		case result := <-resultLinks:
 			done++
-			if len(result.Links) > 0 {
-				pageLinks = append(pageLinks, ResultSearch{Host: result.Link, Links: result.Links})
-			}
-			if done == len(hosts) {
-				request.SuccessJSONResponse(pageLinks)
-				return
-			}
-		case <-time.After(time.Second * 60):
+			hits = append(hits, result.Hits...)
+		case <-timeout:
 			request.ErrorJSONResponse(http.StatusRequestTimeout, fmt.Sprint("Time limit exceed"))
 			return
 		}
 	}
+
+	// Hits are collapsed after filtering, so a page hidden as similar to a filtered out one is still shown
+	var collapseHits func([]SearchHit) []SearchHit
+	if collapse {
+		collapseHits = func(hits []SearchHit) []SearchHit {
+			return collapseSimilar(hits, repository.SimilarityDistance)
+		}
+	}
+	hits, response.Facets = applyFacets(hits, facets, facetFilters, collapseHits)
+	response.Total = len(hits)
+	response.Hits = paginateHits(hits, limit, offset)
+	addStructuredSummaries(response.Hits)
+	if highlightOptions.Fragments > 0 {
+		repository.addSnippets(response.Hits, searchQuery, highlightOptions)
+	}
+	request.SuccessJSONResponse(response)
+}
+
+func (repository Repository) SuggestHandler(request *rou.Context) {
+	prefix := request.Params().Get("prefix")
+	normalizedPrefix := strings.Join(repository.Analyzer.Tokenize(prefix), " ")
+	if normalizedPrefix != "" && strings.HasSuffix(prefix, " ") {
+		normalizedPrefix += " "
+	}
+
+	limit := autocomplete.MaxCompletions
+	if value := request.Params().Get("limit"); value != "" {
+		parsedLimit, err := strconv.Atoi(value)
+		if err != nil || parsedLimit <= 0 {
+			request.ErrorJSONResponse(http.StatusBadRequest, "Limit must be a positive number")
+			return
+		}
+		if parsedLimit < limit {
+			limit = parsedLimit
+		}
+	}
+
+	completions := repository.Vocabulary.Suggester().Suggest(normalizedPrefix, limit)
+	if completions == nil {
+		completions = []autocomplete.Completion{}
+	}
+	request.SuccessJSONResponse(completions)
 }
 
 func (repository Repository) POST_HostsHandler(request *rou.Context) {
@@ -171,7 +676,11 @@ func (repository Repository) POST_HostsHandler(request *rou.Context) {
 	var successCounter int
 
 	for _, host := range hosts {
-		result := repository.DB.MustExec(CreateHostQuery, host)
+		result, err := repository.DB.Exec(CreateHostQuery, host)
+		if err != nil {
+			request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+			return
+		}
 		r, _ := result.RowsAffected()
 		if r > 0 {
 			successCounter++
@@ -189,12 +698,16 @@ func (repository Repository) GET_HostsHandler(request *rou.Context) {
 	var hostsWithEndpoints []HostWithEndpoints
 
 	for _, host := range hosts {
+		feeds, _ := host.GetFeeds(repository.DB)
 		hostsWithEndpoints = append(
 			hostsWithEndpoints,
 			HostWithEndpoints{
-				Host:         host.Name,
-				IsSearchable: host.IsSearchable,
-				Endpoints:    host.GetEndpoints(repository.DB),
+				Host:          host.Name,
+				IsSearchable:  host.IsSearchable,
+				Authenticated: host.CredentialId != nil,
+				Scope:         host.Scope(),
+				Feeds:         feeds,
+				Endpoints:     host.GetEndpoints(repository.DB),
 			},
 		)
 	}
@@ -202,6 +715,200 @@ func (repository Repository) GET_HostsHandler(request *rou.Context) {
 	request.SuccessJSONResponse(hostsWithEndpoints)
 }
 
+// Stores encrypted credential of the host and starts using it for requests to the host.
+// Login credential is checked by logging in before it is stored
+func (repository Repository) POST_HostCredentialsHandler(request *rou.Context) {
+	if repository.Cipher == nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, CredentialsKeyIsMissing)
+		return
+	}
+
+	var body HostCredentialRequest
+	if err := json.NewDecoder(request.Request().Body).Decode(&body); err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, BodyIsNotValid)
+		return
+	}
+	if err := body.Credential.Validate(); err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var host Host
+	err := repository.DB.Get(&host, SelectHostByName, body.Host)
+	if errors.Is(err, sql.ErrNoRows) {
+		request.ErrorJSONResponse(http.StatusNotFound, "Host not found")
+		return
+	}
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+
+	err = repository.Fetcher.SetCredential(host.Name, body.Credential)
+	if errors.Is(err, ErrLoginOnAnotherHost) {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadGateway, fmt.Sprint(err))
+		return
+	}
+
+	secret, err := repository.Cipher.Encrypt(body.Credential)
+	if err == nil {
+		_, err = repository.DB.Exec(SetHostCredential, host.Name, body.Credential.Kind, secret)
+	}
+	if err != nil {
+		repository.Fetcher.Credentials.Remove(host.Name)
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+
+	request.SuccessJSONResponse(body.Credential.Kind)
+}
+
+// Deletes credential of the host from "host" param, pages of the host are requested without it
+func (repository Repository) DELETE_HostCredentialsHandler(request *rou.Context) {
+	host := Host{Name: request.Request().URL.Query().Get("host")}
+	result, err := repository.DB.Exec(DeleteHostCredential, host.Name)
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+	repository.Fetcher.Credentials.Remove(host.Name)
+
+	deleted, _ := result.RowsAffected()
+	request.SuccessJSONResponse(deleted)
+}
+
+// Sets the scope of pages which are followed by links from pages of the host
+func (repository Repository) POST_HostScopeHandler(request *rou.Context) {
+	var body HostScopeRequest
+	if err := json.NewDecoder(request.Request().Body).Decode(&body); err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, BodyIsNotValid)
+		return
+	}
+	if err := body.Scope.Validate(); err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := repository.DB.Exec(UpdateHostScope, body.Host, body.Scope.Kind, pq.Array(body.Scope.Values))
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		request.ErrorJSONResponse(http.StatusNotFound, "Host not found")
+		return
+	}
+	request.SuccessJSONResponse(body.Scope)
+}
+
+// Returns hosts which aren't added yet by number of pages linking to them, paginated
+// with "limit" and "offset" params
+func (repository Repository) GET_HostSuggestionsHandler(request *rou.Context) {
+	limit, offset, err := parsePagination(request.Request().URL.Query())
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	suggestions := []HostSuggestion{}
+	if err := repository.DB.Select(&suggestions, SelectHostSuggestions, limit, offset); err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+	request.SuccessJSONResponse(suggestions)
+}
+
+// Registers the feed of the host which is polled for new pages. The feed is checked by fetching it
+func (repository Repository) POST_HostFeedsHandler(request *rou.Context) {
+	var body HostFeedRequest
+	if err := json.NewDecoder(request.Request().Body).Decode(&body); err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, BodyIsNotValid)
+		return
+	}
+
+	var host Host
+	err := repository.DB.Get(&host, SelectHostByName, body.Host)
+	if errors.Is(err, sql.ErrNoRows) {
+		request.ErrorJSONResponse(http.StatusNotFound, "Host not found")
+		return
+	}
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+
+	feedPath, ok := host.ResolveLink("/", body.URL)
+	if !ok {
+		request.ErrorJSONResponse(http.StatusBadRequest, FeedIsNotOnHost)
+		return
+	}
+	hostURL, _ := url.Parse(host.Name)
+	feedURL, _ := hostURL.Parse(feedPath)
+	_, err = repository.Fetcher.FetchFeed(feedURL.String(), "", "")
+	if errors.Is(err, parser.ErrNotFeed) {
+		request.ErrorJSONResponse(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadGateway, fmt.Sprint(err))
+		return
+	}
+
+	if _, err := repository.DB.Exec(AddHostFeed, host.Id, feedPath); err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+	request.SuccessJSONResponse(feedPath)
+}
+
+// Deletes the feed from "url" param of the host from "host" param
+func (repository Repository) DELETE_HostFeedsHandler(request *rou.Context) {
+	params := request.Request().URL.Query()
+	host := Host{Name: params.Get("host")}
+	feedPath, ok := host.ResolveLink("/", params.Get("url"))
+	if !ok {
+		request.ErrorJSONResponse(http.StatusBadRequest, FeedIsNotOnHost)
+		return
+	}
+
+	result, err := repository.DB.Exec(DeleteHostFeed, host.Name, feedPath)
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+	deleted, _ := result.RowsAffected()
+	request.SuccessJSONResponse(deleted)
+}
+
+// Returns stored endpoint with its metadata and cached search phrases
+func (repository Repository) GET_EndpointHandler(request *rou.Context) {
+	id, err := strconv.Atoi(request.RouterParams().Get("id"))
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusBadRequest, "Endpoint id must be a number")
+		return
+	}
+
+	endpoint, err := GetEndpoint(repository.DB, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		request.ErrorJSONResponse(http.StatusNotFound, "Endpoint not found")
+		return
+	}
+	if err != nil {
+		request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+		return
+	}
+
+	request.SuccessJSONResponse(endpoint)
+}
+
+func (repository Repository) MetricsHandler(request *rou.Context) {
+	request.SuccessJSONResponse(repository.Fetcher.Metrics.Snapshot())
+}
+
 // Add all endpoints by host to DB and activate host
 func (repository Repository) ActivateHosts(request *rou.Context) {
 	defer request.Request().Body.Close()
@@ -230,55 +937,183 @@ func (repository Repository) ActivateHosts(request *rou.Context) {
 	var addedEndpoints int
 
 	for _, host := range dbHosts {
-		response, err := http.Get(host.Name)
+		mainPage, err := repository.Fetcher.Fetch(host.Name)
 		if err != nil {
 			request.ErrorJSONResponse(http.StatusBadGateway, fmt.Sprint(err))
 			return
 		}
-		defer response.Body.Close()
-		body, _ := io.ReadAll(response.Body)
-		clearLinks := parser.ExtractLinks(body)
-
-		host.MustBegin(repository.DB)
-		resultChan := make(chan LinksWithTitle)
-
-		for _, link := range clearLinks {
-			go getLinkWithTitle(host, link, resultChan)
+		var clearLinks []string
+		uniqueLinks := make(map[string]bool)
+		// Links to pages of other hosts in the scope by host name
+		followedLinks := make(map[string][]string)
+		var anchors []parser.Anchor
+		anchors = append(anchors, mainPage.Document.Anchors...)
+		// Entries of feeds are crawled, so pages of sites rendered by JavaScript are indexed
+		// even when the main page has no links
+		fetchedFeeds := make(map[string]FetchedFeed)
+		for _, feed := range mainPage.Document.Feeds {
+			feedPath, fetched, ok := repository.fetchHostFeed(host, feed.Href)
+			if !ok {
+				continue
+			}
+			fetchedFeeds[feedPath] = fetched
+			for _, link := range feedLinks(host, feedPath, fetched.Feed) {
+				anchors = append(anchors, parser.Anchor{Href: link})
+			}
+		}
+		for _, anchor := range anchors {
+			target, scope := host.ClassifyLink("/", anchor.Href)
+			if scope != LinkInternal && scope != LinkFollowed {
+				continue
+			}
+			hostName, link := hostNameOf(target), endpointPath(target)
+			if uniqueLinks[hostName+link] {
+				continue
+			}
+			uniqueLinks[hostName+link] = true
+			if scope == LinkInternal {
+				clearLinks = append(clearLinks, link)
+			} else {
+				followedLinks[hostName] = append(followedLinks[hostName], link)
+			}
 		}
 
-		for i := 0; i < len(clearLinks); i++ {
-			linkWithTitle := <-resultChan
-			host.NewEndpoint(linkWithTitle.Link, linkWithTitle.Title)
+		// Feeds of the host are polled for new pages, which may be not linked from the main page
+		for _, feed := range mainPage.Document.Feeds {
+			feedPath, ok := host.ResolveLink("/", feed.Href)
+			if !ok {
+				continue
+			}
+			if _, err := repository.DB.Exec(AddHostFeed, host.Id, feedPath); err != nil {
+				log.Printf("feed %s of %s isn't added: %v", feedPath, host.Name, err)
+			}
 		}
-		err = host.Commit()
+
+		err = repository.indexLinks(host, clearLinks)
 		if err != nil {
 			request.ErrorJSONResponse(http.StatusBadGateway, fmt.Sprint(err))
 			return
 		}
-		repository.DB.MustExec(ChangeHostsIsSearchableState, host.Name)
+		if _, err := repository.DB.Exec(ChangeHostsIsSearchableState, host.Name); err != nil {
+			request.ErrorJSONResponse(http.StatusInternalServerError, fmt.Sprint(err))
+			return
+		}
+		if err := repository.indexFollowedLinks(followedLinks); err != nil {
+			log.Printf("links of %s to other hosts weren't followed: %v", host.Name, err)
+		}
+		// Entries of the fetched feeds are indexed, so the feeds are stored as polled and aren't downloaded again
+		for feedPath, fetched := range fetchedFeeds {
+			if _, err := repository.DB.Exec(UpdateHostFeedPoll, host.Id, feedPath, fetched.Feed.Title, fetched.ETag, fetched.LastModified); err != nil {
+				log.Printf("poll of feed %s of %s isn't stored: %v", feedPath, host.Name, err)
+			}
+		}
+		if err := repository.UpdateHostAuthority(host); err != nil {
+			log.Printf("authority update of %s failed: %v", host.Name, err)
+		}
 	}
 
 	request.SuccessJSONResponse(addedEndpoints)
 }
 
-func getLinkWithTitle(host Host, link string, resultChan chan<- LinksWithTitle) {
-	requestURL := &url.URL{Host: host.Name[8 : len(host.Name)-1], Scheme: "https", Path: link}
-
-	response, err := http.Get(requestURL.String())
+// Fetches the feed of the host by its link from the main page. Returns path of the feed, ok is false
+// when the feed isn't on the host or isn't fetched
+func (repository Repository) fetchHostFeed(host Host, href string) (string, FetchedFeed, bool) {
+	feedPath, ok := host.ResolveLink("/", href)
+	if !ok {
+		return "", FetchedFeed{}, false
+	}
+	hostURL, err := url.Parse(host.Name)
 	if err != nil {
-		return
+		return "", FetchedFeed{}, false
+	}
+	feedURL, err := hostURL.Parse(feedPath)
+	if err != nil {
+		return "", FetchedFeed{}, false
+	}
+	// The error is logged by the fetcher
+	fetched, err := repository.Fetcher.FetchFeed(feedURL.String(), "", "")
+	if err != nil {
+		return "", FetchedFeed{}, false
 	}
+	return feedPath, fetched, true
+}
+
+// Fetches the links of the host and stores them as endpoints with their terms, content and links
+func (repository Repository) indexLinks(host Host, links []string) error {
+	resultChan := make(chan PageSearchResult)
+	errChan := make(chan error)
 
-	defer response.Body.Close()
+	queue := linksQueue(links)
+	for i := 0; i < MaxHostRequests && i < len(links); i++ {
+		go func() {
+			for link := range queue {
+				getLinkWithTitle(repository.Fetcher, host, link, repository.Analyzer, resultChan, errChan)
+			}
+		}()
+	}
 
-	html, _ := io.ReadAll(response.Body)
+	var pages []PageSearchResult
+	for i := 0; i < len(links); i++ {
+		select {
+		case page := <-resultChan:
+			pages = append(pages, page)
+		case <-errChan:
+			// Links which weren't fetched are skipped, the error is logged by the fetcher
+		}
+	}
+
+	if err := host.Begin(repository.DB); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := storePage(host, page); err != nil {
+			host.Rollback()
+			return err
+		}
+	}
+	return host.Commit()
+}
+
+func getLinkWithTitle(fetcher *Fetcher, host Host, link string, textAnalyzer analyzer.Analyzer, resultChan chan<- PageSearchResult, errChan chan<- error) {
+	requestURL, err := endpointURL(host.Name, link)
 	if err != nil {
+		errChan <- err
 		return
 	}
-	resultChan <- LinksWithTitle{Link: link, Title: parser.ExtractTitle(html)}
+
+	page, err := fetcher.Fetch(requestURL.String())
+	if err != nil && !isPermanentFailure(err) {
+		errChan <- err
+		return
+	}
+	resultChan <- newPageSearchResult(link, page, textAnalyzer.Tokenize(page.Document.Text))
 }
 
 func main() {
+	stripDiacritics := flag.Bool("strip-diacritics", false, "Match words regardless of accents, e.g. \"cafe\" and \"café\"")
+	maxBodySize := flag.Int64("max-body-size", DefaultMaxBodySize, "Maximum number of bytes read from a response, larger bodies are truncated. Also limits bytes decompressed from streams of a PDF document")
+	defaultCharset := flag.String("default-charset", parser.DefaultCharset, "Charset of pages which are not valid UTF-8 and don't declare their charset, e.g. \"windows-1251\"")
+	allowedContentTypes := flag.String("allowed-content-types", strings.Join(DefaultAllowedContentTypes, ","), "Comma separated media types which are downloaded, \"*\" matches any part of the type")
+	maxRedirects := flag.Int("max-redirects", DefaultMaxRedirects, "Maximum number of redirects followed for a page")
+	followCrossHostRedirects := flag.Bool("follow-cross-host-redirects", false, "Follow redirects of pages to other hosts")
+	maxRetries := flag.Int("max-retries", DefaultMaxRetries, "Number of retries of responses with status 429 and 5xx")
+	requestTimeout := flag.Duration("request-timeout", DefaultRequestTimeout, "Time limit of a request including redirects and reading the body")
+	crawlerName := flag.String("crawler-name", DefaultCrawlerName, "Name and version of the crawler sent in User-Agent header, the name is matched by robots.txt")
+	crawlerContactURL := flag.String("crawler-contact-url", "", "Page which describes the crawler, added to User-Agent header")
+	crawlerFrom := flag.String("crawler-from", "", "E-mail of the crawler operator sent in From header")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Crawl pages which robots.txt disallows, e.g. of own intranet sites")
+	hostHeadersPath := flag.String("host-headers", "", "JSON file with headers sent only to their hosts, e.g. {\"intranet.local\": {\"Cookie\": \"session=1\"}}")
+	credentialsKeyFile := flag.String("credentials-key-file", "", "File with hex encoded 32 bytes key which encrypts credentials of hosts")
+	similarityDistance := flag.Int("similarity-distance", DefaultSimilarityDistance, "Maximum number of different bits of content fingerprints for pages to be collapsed in search results as similar")
+	authorityWeight := flag.Float64("authority-weight", DefaultAuthorityWeight, "Weight of page authority computed by links in the score of search hits, 0 disables it")
+	authorityRefresh := flag.Duration("authority-refresh", time.Hour, "How often authority of pages is recomputed from the link graph")
+	feedPollInterval := flag.Duration("feed-poll-interval", 15*time.Minute, "How often feeds of searchable hosts are polled for new pages")
+	crawlInterval := flag.Duration("crawl-interval", 5*time.Minute, "How often pages of searchable hosts which are known only by links are crawled")
+	crawlBatch := flag.Int("crawl-batch", DefaultCrawlBatch, "Number of pages of every host which are crawled at once by the crawl queue")
+	vocabularyRefresh := flag.Duration("vocabulary-refresh", 5*time.Minute, "How often spelling dictionary and autocomplete are rebuilt from indexed terms and past searches")
+	flag.Parse()
+	parser.DefaultCharset = *defaultCharset
+
 	db, err := sqlx.Connect("postgres", "user=root password=123456 dbname=search_engine sslmode=disable")
 
 	if err != nil {
@@ -286,11 +1121,51 @@ func main() {
 	}
 
 	repository := NewRepository(db)
+	repository.Analyzer.StripDiacritics = *stripDiacritics
+	repository.AuthorityWeight = *authorityWeight
+	repository.SimilarityDistance = *similarityDistance
+	repository.Fetcher.MaxBodySize = *maxBodySize
+	parser.MaxDecodedSize = *maxBodySize
+	repository.Fetcher.AllowedContentTypes = strings.Split(*allowedContentTypes, ",")
+	repository.Fetcher.MaxRedirects = *maxRedirects
+	repository.Fetcher.FollowCrossHostRedirects = *followCrossHostRedirects
+	repository.Fetcher.MaxRetries = *maxRetries
+	repository.Fetcher.Client.Timeout = *requestTimeout
+	repository.Fetcher.Identity = CrawlerIdentity{Name: *crawlerName, ContactURL: *crawlerContactURL, From: *crawlerFrom}
+	repository.Fetcher.IgnoreRobots = *ignoreRobots
+	if *hostHeadersPath != "" {
+		repository.Fetcher.HostHeaders, err = LoadHostHeaders(*hostHeadersPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *credentialsKeyFile != "" {
+		repository.Cipher, err = credentials.LoadCipher(*credentialsKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := repository.LoadCredentials(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	go repository.WatchVocabulary(*vocabularyRefresh)
+	go repository.WatchAuthority(*authorityRefresh)
+	go repository.WatchFeeds(*feedPollInterval)
+	go repository.WatchLinkedEndpoints(*crawlInterval, *crawlBatch)
 	router := rou.NewRouter()
 
 	router.Get("/search", repository.SearchHandler)
+	router.Get("/suggest", repository.SuggestHandler)
 	router.Get("/hosts/list", repository.GET_HostsHandler)
+	router.Get("/endpoints/:id", repository.GET_EndpointHandler)
+	router.Get("/metrics", repository.MetricsHandler)
 	router.Post("/hosts/add", repository.POST_HostsHandler)
 	router.Post("/hosts/activate", repository.ActivateHosts)
+	router.Post("/hosts/credentials", repository.POST_HostCredentialsHandler)
+	router.Delete("/hosts/credentials", repository.DELETE_HostCredentialsHandler)
+	router.Get("/hosts/suggestions", repository.GET_HostSuggestionsHandler)
+	router.Post("/hosts/scope", repository.POST_HostScopeHandler)
+	router.Post("/hosts/feeds", repository.POST_HostFeedsHandler)
+	router.Delete("/hosts/feeds", repository.DELETE_HostFeedsHandler)
 	log.Fatal(router.RunServer(":8080"))
 }
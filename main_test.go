@@ -1 +1,1994 @@
 package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Moranilt/rou"
+	"github.com/Moranilt/search-engine/autocomplete"
+	"github.com/Moranilt/search-engine/credentials"
+	"github.com/Moranilt/search-engine/highlight"
+	"github.com/Moranilt/search-engine/parser"
+	"github.com/Moranilt/search-engine/query"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Integration tests run against a real Postgres, e.g. the one from
+// docker-compose.yml:
+//
+//	TEST_DATABASE_URL="user=root password=123456 dbname=search_engine sslmode=disable" go test ./...
+//
+// Every test gets its own schema loaded from dumps/hosts.sql which is dropped afterwards.
+func newTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin.MustExec("CREATE SCHEMA " + schema)
+
+	db, err := sqlx.Connect("postgres", dsn+" search_path="+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.MustExec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	dump, err := os.ReadFile("dumps/hosts.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.MustExec(string(dump))
+	db.MustExec("DELETE FROM hosts")
+
+	return db
+}
+
+func createTestHost(t *testing.T, db *sqlx.DB, name string) Host {
+	t.Helper()
+
+	db.MustExec(CreateHostQuery, name)
+	var host Host
+	if err := db.Get(&host, SelectHostByName, name); err != nil {
+		t.Fatal(err)
+	}
+	return host
+}
+
+func TestGetEndpointsWithoutSearchPhrase(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	nasa := createTestHost(t, db, "https://www.nasa.gov/")
+
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1", Language: "en"})
+	spacex.NewEndpoint("/launches", "Launches", EndpointMetadata{ContentHash: "l1", Language: "en"})
+	spacex.NewEndpoint("/careers", "Careers", EndpointMetadata{ContentHash: "c1", Language: "en"})
+	spacex.StoreEndpointByPhrase("/vehicles", "falcon", "Vehicles")
+	spacex.StoreEndpointByPhrase("/vehicles", "dragon", "Vehicles")
+	spacex.StoreEndpointByPhrase("/vehicles", "starship", "Vehicles")
+	spacex.StoreEndpointByPhrase("/launches", "dragon", "Launches")
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	nasa.MustBegin(db)
+	nasa.NewEndpoint("/missions", "Missions", EndpointMetadata{ContentHash: "m1", Language: "en"})
+	if err := nasa.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("returns only endpoints of the host", func(t *testing.T) {
+		got := nasa.GetEndpointsWithoutSearchPhrase(db, "falcon")
+		want := []string{"/missions"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("skips endpoints which already have the phrase", func(t *testing.T) {
+		got := spacex.GetEndpointsWithoutSearchPhrase(db, "falcon")
+		sort.Strings(got)
+		want := []string{"/careers", "/launches"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("returns every endpoint once", func(t *testing.T) {
+		got := spacex.GetEndpointsWithoutSearchPhrase(db, "falcon heavy")
+		sort.Strings(got)
+		want := []string{"/careers", "/launches", "/vehicles"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestNegativeResultCache(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1", Language: "en"})
+	spacex.NewEndpoint("/launches", "Launches", EndpointMetadata{ContentHash: "l1", Language: "en"})
+	spacex.StoreEndpointWithoutPhrase("/vehicles", "falcon", "v1")
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("skips endpoints known to miss the phrase", func(t *testing.T) {
+		got := spacex.GetEndpointsWithoutSearchPhrase(db, "falcon")
+		want := []string{"/launches"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("keeps cache when page is re-crawled without changes", func(t *testing.T) {
+		spacex.MustBegin(db)
+		spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1", Language: "en"})
+		if err := spacex.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := spacex.GetEndpointsWithoutSearchPhrase(db, "falcon")
+		want := []string{"/launches"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("invalidates cache when page content has changed", func(t *testing.T) {
+		spacex.MustBegin(db)
+		spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v2", Language: "en"})
+		if err := spacex.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := spacex.GetEndpointsWithoutSearchPhrase(db, "falcon")
+		sort.Strings(got)
+		want := []string{"/launches", "/vehicles"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("drops found phrases when page content has changed", func(t *testing.T) {
+		spacex.MustBegin(db)
+		spacex.StoreEndpointByPhrase("/launches", "starship", "Launches")
+		spacex.NewEndpoint("/launches", "Launches", EndpointMetadata{ContentHash: "l2", Language: "en"})
+		if err := spacex.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := spacex.GetEndpointsWithSearchPhrase(db, "starship"); len(got) != 0 {
+			t.Errorf("got %v, want no endpoints", got)
+		}
+	})
+}
+
+func TestHostHostname(t *testing.T) {
+	tests := map[string]string{
+		"https://www.spacex.com/":  "www.spacex.com",
+		"http://localhost:8080/":   "localhost",
+		"www.nasa.gov/":            "www.nasa.gov",
+		"https://blog.example.com": "blog.example.com",
+	}
+
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Host{Name: name}.Hostname()
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestGetEndpointsMetadata(t *testing.T) {
+	db := newTestDB(t)
+
+	lastModified := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+	launches := EndpointMetadata{
+		StatusCode:    http.StatusOK,
+		ContentType:   "text/html",
+		ContentLength: 2048,
+		ContentHash:   "l1",
+		LastModified:  &lastModified,
+		Description:   "Расписание запусков",
+		CanonicalURL:  "https://www.roscosmos.ru/launches/",
+		Language:      "ru",
+		OutboundLinks: 12,
+	}
+
+	host := createTestHost(t, db, "https://www.roscosmos.ru/")
+	host.MustBegin(db)
+	host.NewEndpoint("/launches", "Запуски", launches)
+	host.NewEndpoint("/media", "Media", EndpointMetadata{ContentHash: "m1"})
+	if err := host.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := host.GetEndpoints(db)
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	if len(got) != 2 {
+		t.Fatalf("got %v, want 2 endpoints", got)
+	}
+	for _, endpoint := range got {
+		if endpoint.Id == 0 || endpoint.CrawledAt == nil {
+			t.Errorf("%s: id and crawl time must be set, got %v", endpoint.Path, endpoint)
+		}
+	}
+
+	metadata := got[0].EndpointMetadata
+	if metadata.LastModified == nil || !metadata.LastModified.Equal(lastModified) {
+		t.Errorf("got last modified %v, want %v", metadata.LastModified, lastModified)
+	}
+	metadata.LastModified, metadata.CrawledAt, launches.LastModified = nil, nil, nil
+	if !reflect.DeepEqual(metadata, launches) {
+		t.Errorf("got %+v, want %+v", metadata, launches)
+	}
+	if got[1].ContentHash != "m1" || got[1].Language != "" || got[1].StatusCode != 0 {
+		t.Errorf("got %+v, want only content hash", got[1].EndpointMetadata)
+	}
+}
+
+func TestGetEndpoint(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1", StatusCode: http.StatusOK})
+	spacex.StoreEndpointByPhrase("/vehicles", "falcon", "Vehicles")
+	spacex.StoreEndpointWithoutPhrase("/vehicles", "starlink", "v1")
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	id := spacex.GetEndpoints(db)[0].Id
+	got, err := GetEndpoint(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Host != spacex.Name || got.Path != "/vehicles" || got.Title != "Vehicles" || got.StatusCode != http.StatusOK {
+		t.Errorf("got %+v", got)
+	}
+	if want := []string{"falcon"}; !reflect.DeepEqual(got.Phrases, want) {
+		t.Errorf("got phrases %v, want %v", got.Phrases, want)
+	}
+	if want := []string{"starlink"}; !reflect.DeepEqual(got.MissingPhrases, want) {
+		t.Errorf("got missing phrases %v, want %v", got.MissingPhrases, want)
+	}
+
+	if _, err := GetEndpoint(db, id+1000); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Phrases of the previous content are dropped when the content changes
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v2", StatusCode: http.StatusOK})
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = GetEndpoint(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Phrases) != 0 || len(got.MissingPhrases) != 0 {
+		t.Errorf("got phrases %v and missing phrases %v after the content has changed", got.Phrases, got.MissingPhrases)
+	}
+}
+
+func TestGetEndpointsLatestTitle(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	for i, title := range []string{"Vehicles", "Falcon 9", "Vehicles"} {
+		spacex.MustBegin(db)
+		spacex.NewEndpoint("/vehicles", title, EndpointMetadata{ContentHash: fmt.Sprint("v", i), StatusCode: http.StatusOK})
+		if err := spacex.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := spacex.GetEndpoints(db)
+	if len(got) != 1 || got[0].Title != "Vehicles" {
+		t.Fatalf("got %+v, want one endpoint with the latest title", got)
+	}
+	endpoint, err := GetEndpoint(db, got[0].Id)
+	if err != nil || endpoint.Title != "Vehicles" {
+		t.Errorf("got %+v, %v, want the latest title", endpoint, err)
+	}
+}
+
+func TestGetEndpointHandlerBadId(t *testing.T) {
+	router := rou.NewRouter()
+	router.Get("/endpoints/:id", NewRepository(nil).GET_EndpointHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/endpoints/vehicles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", response.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestRefreshVocabulary(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1", Language: "en"})
+	spacex.StoreEndpointTerms("/vehicles", []string{"falcon", "dragon"})
+	spacex.NewEndpoint("/launches", "Launches", EndpointMetadata{ContentHash: "l1", Language: "en"})
+	spacex.StoreEndpointTerms("/launches", []string{"falcon", "launch"})
+	spacex.StoreEndpointTerms("/launches", []string{"falcon", "starship"})
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec(CountPhraseSearch, "falcon heavy")
+	db.MustExec(CountPhraseSearch, "falcon heavy")
+
+	repository := NewRepository(db)
+	if err := repository.RefreshVocabulary(); err != nil {
+		t.Fatal(err)
+	}
+
+	completions := repository.Vocabulary.Suggester().Suggest("falc", 10)
+	wantCompletions := []autocomplete.Completion{
+		{Text: "falcon heavy", Count: 2, Source: autocomplete.SourcePhrase},
+		{Text: "falcon", Count: 2, Source: autocomplete.SourceTerm},
+	}
+	if !reflect.DeepEqual(completions, wantCompletions) {
+		t.Errorf("got %v, want %v", completions, wantCompletions)
+	}
+
+	dictionary := repository.Vocabulary.Dictionary()
+	want := map[string]int{"falcon": 2, "dragon": 1, "starship": 1, "launch": 0}
+	for term, frequency := range want {
+		if got := dictionary.Frequency(term); got != frequency {
+			t.Errorf("Frequency(%q) got %d, want %d", term, got, frequency)
+		}
+	}
+	if got := dictionary.Correct("falcn"); got != "falcon" {
+		t.Errorf("got %q, want %q", got, "falcon")
+	}
+}
+
+func TestSuggestHandler(t *testing.T) {
+	repository := NewRepository(nil)
+	repository.Vocabulary.suggester.Store(autocomplete.NewSuggester(
+		map[string]int{"launch window": 3},
+		map[string]int{"launch": 5, "launches": 2, "weather": 1},
+	))
+
+	router := rou.NewRouter()
+	router.Get("/suggest", repository.SuggestHandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{query: "?prefix=LAUNCH", status: http.StatusOK, want: []string{"launch window", "launch", "launches"}},
+		{query: "?prefix=Launch+W&limit=1", status: http.StatusOK, want: []string{"launch window"}},
+		{query: "?prefix=mars", status: http.StatusOK, want: []string{}},
+		{query: "?prefix=launch&limit=zero", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			response, err := http.Get(server.URL + "/suggest" + test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			if response.StatusCode != test.status {
+				t.Fatalf("got status %d, want %d", response.StatusCode, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var body rou.ResponseObject[[]autocomplete.Completion]
+			if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, completion := range body.Body {
+				got = append(got, completion.Text)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetEndpointsContent(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1", Language: "en"})
+	spacex.StoreEndpointContent("/vehicles", "Falcon 9 and Falcon Heavy")
+	spacex.NewEndpoint("/careers", "Careers", EndpointMetadata{ContentHash: "c1", Language: "en"})
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := spacex.GetEndpointsContent(db, []string{"/vehicles", "/careers", "/missing"})
+	want := map[string]string{"/vehicles": "Falcon 9 and Falcon Heavy", "/careers": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStorePageWithNUL(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	page := PageSearchResult{
+		LinksWithTitle:   LinksWithTitle{Link: "/vehicles", Title: "Vehi\x00cles"},
+		EndpointMetadata: EndpointMetadata{ContentHash: "v1", Description: "Falcon\x00 9"},
+		Text:             "Falcon\x00 9 and Falcon Heavy",
+		Anchors:          []parser.Anchor{{Href: "/launches", Text: "Laun\x00ches"}},
+	}
+	if err := spacex.Begin(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := storePage(spacex, page); err != nil {
+		spacex.Rollback()
+		t.Fatal(err)
+	}
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := spacex.GetEndpointsContent(db, []string{"/vehicles"})
+	if want := map[string]string{"/vehicles": "Falcon 9 and Falcon Heavy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseHighlightOptions(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		got, err := parseHighlightOptions(url.Values{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := highlight.DefaultOptions(); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		got, err := parseHighlightOptions(url.Values{
+			"snippets":  {"0"},
+			"highlight": {"offsets"},
+			"pre_tag":   {"<b>"},
+			"post_tag":  {""},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := highlight.DefaultOptions()
+		want.Fragments, want.Offsets, want.PreTag, want.PostTag = 0, true, "<b>", ""
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	for _, params := range []url.Values{{"snippets": {"-1"}}, {"snippets": {"two"}}, {"highlight": {"bold"}}} {
+		if _, err := parseHighlightOptions(params); err == nil {
+			t.Errorf("expected error for %v", params)
+		}
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		params     url.Values
+		limit      int
+		offset     int
+		shouldFail bool
+	}{
+		{params: url.Values{}, limit: DefaultSearchLimit, offset: 0},
+		{params: url.Values{"limit": {"20"}, "offset": {"40"}}, limit: 20, offset: 40},
+		{params: url.Values{"limit": {"100000"}}, limit: MaxSearchLimit, offset: 0},
+		{params: url.Values{"limit": {"0"}}, shouldFail: true},
+		{params: url.Values{"offset": {"-10"}}, shouldFail: true},
+		{params: url.Values{"offset": {"ten"}}, shouldFail: true},
+	}
+
+	for _, test := range tests {
+		limit, offset, err := parsePagination(test.params)
+		if test.shouldFail {
+			if err == nil {
+				t.Errorf("expected error for %v", test.params)
+			}
+			continue
+		}
+		if err != nil || limit != test.limit || offset != test.offset {
+			t.Errorf("%v: got %d, %d, %v, want %d, %d", test.params, limit, offset, err, test.limit, test.offset)
+		}
+	}
+}
+
+func TestPaginateHits(t *testing.T) {
+	newHit := func(host string, link string, score float64) SearchHit {
+		return SearchHit{Host: host, LinksWithTitle: LinksWithTitle{Link: link}, Score: score}
+	}
+	hits := []SearchHit{
+		newHit("https://www.spacex.com/", "/careers", 1),
+		newHit("https://www.spacex.com/", "/vehicles", 3),
+		newHit("https://www.nasa.gov/", "/missions", 1),
+		newHit("https://www.spacex.com/", "/launches", 2),
+		newHit("https://www.nasa.gov/", "/artemis", 1),
+	}
+
+	links := func(hits []SearchHit) []string {
+		result := []string{}
+		for _, hit := range hits {
+			result = append(result, hit.Link)
+		}
+		return result
+	}
+
+	tests := []struct {
+		limit, offset int
+		want          []string
+	}{
+		{limit: 2, offset: 0, want: []string{"/vehicles", "/launches"}},
+		{limit: 2, offset: 2, want: []string{"/artemis", "/missions"}},
+		{limit: 2, offset: 4, want: []string{"/careers"}},
+		{limit: 2, offset: 10, want: []string{}},
+	}
+
+	for _, test := range tests {
+		got := links(paginateHits(hits, test.limit, test.offset))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("limit %d, offset %d: got %v, want %v", test.limit, test.offset, got, test.want)
+		}
+	}
+}
+
+func TestParseFacets(t *testing.T) {
+	facets, filters, err := parseFacets(url.Values{
+		"facets":   {"host, language,host"},
+		"host":     {"www.spacex.com", "www.nasa.gov"},
+		"language": {"en"},
+		"text":     {"falcon"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{FacetHost, FacetLanguage}; !reflect.DeepEqual(facets, want) {
+		t.Errorf("got facets %v, want %v", facets, want)
+	}
+	wantFilters := map[string][]string{
+		FacetHost:     {"www.spacex.com", "www.nasa.gov"},
+		FacetLanguage: {"en"},
+	}
+	if !reflect.DeepEqual(filters, wantFilters) {
+		t.Errorf("got filters %v, want %v", filters, wantFilters)
+	}
+
+	if _, _, err := parseFacets(url.Values{"facets": {"host,color"}}); err == nil {
+		t.Error("expected error for unknown facet")
+	}
+}
+
+func TestApplyFacets(t *testing.T) {
+	newHit := func(host string, path string, language string, contentType string, schemaTypes ...string) SearchHit {
+		return SearchHit{
+			LinksWithTitle: LinksWithTitle{Link: path},
+			page:           query.Page{Host: host, Path: path, Language: language, ContentType: contentType, SchemaTypes: schemaTypes},
+		}
+	}
+	hits := []SearchHit{
+		newHit("www.spacex.com", "/vehicles/falcon-9", "en", "text/html", "Product"),
+		newHit("www.spacex.com", "/vehicles/dragon", "en", "text/html", "Product", "Article"),
+		newHit("www.spacex.com", "/", "en", "text/html"),
+		newHit("www.nasa.gov", "/missions/artemis", "en", "application/pdf"),
+		newHit("www.roscosmos.ru", "/launches", "ru", "", "Event"),
+	}
+
+	t.Run("counts", func(t *testing.T) {
+		filtered, facets := applyFacets(hits, facetNames, nil, nil)
+		if len(filtered) != len(hits) {
+			t.Errorf("got %d hits, want %d", len(filtered), len(hits))
+		}
+		want := map[string][]FacetCount{
+			FacetHost:     {{"www.spacex.com", 3}, {"www.nasa.gov", 1}, {"www.roscosmos.ru", 1}},
+			FacetSection:  {{"/vehicles", 2}, {"/", 1}, {"/launches", 1}, {"/missions", 1}},
+			FacetLanguage: {{"en", 4}, {"ru", 1}},
+			FacetType:     {{"text/html", 3}, {"application/pdf", 1}},
+			FacetSchema:   {{"Product", 2}, {"Article", 1}, {"Event", 1}},
+		}
+		if !reflect.DeepEqual(facets, want) {
+			t.Errorf("got %v, want %v", facets, want)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		filtered, facets := applyFacets(hits, []string{FacetHost, FacetSection}, map[string][]string{
+			FacetHost:    {"WWW.SPACEX.COM"},
+			FacetSection: {"/vehicles"},
+		}, nil)
+		var links []string
+		for _, hit := range filtered {
+			links = append(links, hit.Link)
+		}
+		if want := []string{"/vehicles/falcon-9", "/vehicles/dragon"}; !reflect.DeepEqual(links, want) {
+			t.Errorf("got %v, want %v", links, want)
+		}
+		// Every facet ignores its own filter
+		want := map[string][]FacetCount{
+			FacetHost:    {{"www.spacex.com", 2}},
+			FacetSection: {{"/vehicles", 2}, {"/", 1}},
+		}
+		if !reflect.DeepEqual(facets, want) {
+			t.Errorf("got %v, want %v", facets, want)
+		}
+	})
+
+	t.Run("schema types", func(t *testing.T) {
+		filtered, _ := applyFacets(hits, nil, map[string][]string{FacetSchema: {"article", "event"}}, nil)
+		var links []string
+		for _, hit := range filtered {
+			links = append(links, hit.Link)
+		}
+		if want := []string{"/vehicles/dragon", "/launches"}; !reflect.DeepEqual(links, want) {
+			t.Errorf("got %v, want %v", links, want)
+		}
+	})
+
+	t.Run("collapsed", func(t *testing.T) {
+		similar := append([]SearchHit(nil), hits...)
+		similar[0].simhash, similar[1].simhash = 1, 1
+		collapse := func(hits []SearchHit) []SearchHit {
+			return collapseSimilar(hits, 0)
+		}
+		filtered, facets := applyFacets(similar, []string{FacetHost, FacetLanguage}, map[string][]string{FacetLanguage: {"en"}}, collapse)
+		if len(filtered) != 3 {
+			t.Errorf("got %d hits, want 3 after collapse", len(filtered))
+		}
+		// Counts are taken over the collapsed hits, like the total
+		want := map[string][]FacetCount{
+			FacetHost:     {{"www.spacex.com", 2}, {"www.nasa.gov", 1}},
+			FacetLanguage: {{"en", 3}, {"ru", 1}},
+		}
+		if !reflect.DeepEqual(facets, want) {
+			t.Errorf("got %v, want %v", facets, want)
+		}
+	})
+
+	t.Run("not requested", func(t *testing.T) {
+		if _, facets := applyFacets(hits, nil, nil, nil); facets != nil {
+			t.Errorf("got %v, want nil", facets)
+		}
+	})
+}
+
+func TestResolveLink(t *testing.T) {
+	host := Host{Name: "https://www.spacex.com/"}
+	tests := []struct {
+		source string
+		href   string
+		want   string
+		ok     bool
+	}{
+		{source: "/", href: "/vehicles", want: "/vehicles", ok: true},
+		{source: "/vehicles/", href: "falcon-9?tab=specs#top", want: "/vehicles/falcon-9?tab=specs", ok: true},
+		{source: "/vehicles/falcon-9", href: "../launches", want: "/launches", ok: true},
+		{source: "/launches", href: "https://WWW.SPACEX.COM", want: "/", ok: true},
+		{source: "/launches", href: "//www.spacex.com/careers", want: "/careers", ok: true},
+		{source: "/launches", href: "https://www.nasa.gov/", ok: false},
+		{source: "/launches", href: "ftp://www.spacex.com/files", ok: false},
+	}
+
+	for _, test := range tests {
+		got, ok := host.ResolveLink(test.source, test.href)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ResolveLink(%q, %q) got %q, %v, want %q, %v", test.source, test.href, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestHostScope(t *testing.T) {
+	tests := []struct {
+		scope HostScope
+		page  string
+		want  bool
+	}{
+		{scope: HostScope{Kind: ScopeHost}, page: "https://www.spacex.com/vehicles", want: true},
+		{scope: HostScope{Kind: ScopeHost}, page: "https://blog.spacex.com/", want: false},
+		{scope: HostScope{Kind: ScopeSubdomains}, page: "https://blog.spacex.com/", want: true},
+		{scope: HostScope{Kind: ScopeSubdomains}, page: "https://SPACEX.COM/", want: true},
+		{scope: HostScope{Kind: ScopeSubdomains}, page: "https://notspacex.com/", want: false},
+		{scope: HostScope{Kind: ScopePathPrefix, Values: []string{"/vehicles/"}}, page: "https://www.spacex.com/vehicles/dragon", want: true},
+		{scope: HostScope{Kind: ScopePathPrefix, Values: []string{"/vehicles/"}}, page: "https://www.spacex.com/launches", want: false},
+		{scope: HostScope{Kind: ScopePathPrefix, Values: []string{"/"}}, page: "https://blog.spacex.com/", want: false},
+		{scope: HostScope{Kind: ScopeAllowlist, Values: []string{"www.nasa.gov", "*.starlink.com"}}, page: "https://www.nasa.gov/", want: true},
+		{scope: HostScope{Kind: ScopeAllowlist, Values: []string{"www.nasa.gov", "*.starlink.com"}}, page: "https://api.starlink.com/", want: true},
+		{scope: HostScope{Kind: ScopeAllowlist, Values: []string{"www.nasa.gov", "*.starlink.com"}}, page: "https://starlink.com/", want: false},
+		{scope: HostScope{Kind: ScopeAllowlist, Values: []string{"www.nasa.gov"}}, page: "https://www.spacex.com/", want: true},
+	}
+
+	for _, test := range tests {
+		page, _ := url.Parse(test.page)
+		if got := test.scope.Contains("www.spacex.com", page); got != test.want {
+			t.Errorf("%+v Contains(%q) got %v, want %v", test.scope, test.page, got, test.want)
+		}
+	}
+
+	for _, invalid := range []HostScope{
+		{Kind: "domain"},
+		{Kind: ScopeHost, Values: []string{"/docs"}},
+		{Kind: ScopePathPrefix},
+		{Kind: ScopePathPrefix, Values: []string{"docs"}},
+		{Kind: ScopeAllowlist, Values: []string{"https://www.nasa.gov/"}},
+		{Kind: ScopeAllowlist, Values: []string{"*."}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected error for %+v", invalid)
+		}
+	}
+}
+
+func TestClassifyLink(t *testing.T) {
+	host := Host{Name: "https://www.spacex.com/", ScopeKind: string(ScopePathPrefix), ScopeValues: []string{"/vehicles/"}}
+	tests := []struct {
+		href   string
+		target string
+		scope  LinkScope
+	}{
+		{href: "dragon", target: "https://www.spacex.com/vehicles/dragon", scope: LinkInternal},
+		{href: "/launches", target: "https://www.spacex.com/launches", scope: LinkExcluded},
+		{href: "https://www.nasa.gov/missions", target: "https://www.nasa.gov/missions", scope: LinkExternal},
+		{href: "ftp://www.spacex.com/files", scope: LinkInvalid},
+	}
+
+	for _, test := range tests {
+		target, scope := host.ClassifyLink("/vehicles/", test.href)
+		if scope != test.scope || (target != nil) != (test.target != "") || target != nil && target.String() != test.target {
+			t.Errorf("ClassifyLink(%q) got %v, %v, want %q, %v", test.href, target, scope, test.target, test.scope)
+		}
+	}
+
+	host = Host{Name: "https://www.spacex.com/", ScopeKind: string(ScopeSubdomains)}
+	if target, scope := host.ClassifyLink("/", "https://Blog.SpaceX.com/posts?page=2"); scope != LinkFollowed || hostNameOf(target) != "https://blog.spacex.com/" || endpointPath(target) != "/posts?page=2" {
+		t.Errorf("got %v, %v, want followed link to blog.spacex.com", target, scope)
+	}
+}
+
+func TestHostNameOf(t *testing.T) {
+	tests := map[string]string{
+		"https://Blog.SpaceX.com/posts":     "https://blog.spacex.com/",
+		"http://www.nasa.gov/missions":      "http://www.nasa.gov/",
+		"https://www.nasa.gov:443/missions": "https://www.nasa.gov/",
+		"http://localhost:8080/":            "http://localhost:8080/",
+	}
+
+	for page, want := range tests {
+		pageURL, _ := url.Parse(page)
+		if got := hostNameOf(pageURL); got != want {
+			t.Errorf("%s: got %q, want %q", page, got, want)
+		}
+	}
+}
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		host     string
+		endpoint string
+		want     string
+	}{
+		{"https://www.spacex.com/", "/launches?page=2", "https://www.spacex.com/launches?page=2"},
+		{"http://localhost:8080/", "/vehicles/falcon%209", "http://localhost:8080/vehicles/falcon%209"},
+	}
+
+	for _, test := range tests {
+		got, err := endpointURL(test.host, test.endpoint)
+		if err != nil || got.String() != test.want {
+			t.Errorf("got %v, %v, want %q", got, err, test.want)
+		}
+	}
+}
+
+func TestStorePageLinksByScope(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	db.MustExec(UpdateHostScope, spacex.Name, ScopeSubdomains, pq.Array([]string{}))
+	if err := db.Get(&spacex, SelectHostByName, spacex.Name); err != nil {
+		t.Fatal(err)
+	}
+	createTestHost(t, db, "https://www.nasa.gov/")
+
+	page := PageSearchResult{LinksWithTitle: LinksWithTitle{Link: "/"}}
+	page.Anchors = []parser.Anchor{
+		{Href: "/vehicles", Text: "Vehicles"},
+		{Href: "https://blog.spacex.com/posts", Text: "Blog"},
+		{Href: "https://www.nasa.gov/", Text: "NASA"},
+		{Href: "https://www.esa.int/", Text: "ESA"},
+	}
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/", "SpaceX", EndpointMetadata{ContentHash: "h1"})
+	storePageLinks(spacex, page)
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var blog Host
+	if err := db.Get(&blog, SelectHostByName, "https://blog.spacex.com/"); err != nil {
+		t.Fatalf("followed host isn't created: %v", err)
+	}
+	if !blog.EndpointContains(db, "/posts") || !spacex.EndpointContains(db, "/vehicles") {
+		t.Error("linked endpoints aren't created")
+	}
+	if endpoints := blog.GetEndpoints(db); len(endpoints) != 1 || endpoints[0].Path != "/posts" || !endpoints[0].IsLinkedOnly() {
+		t.Errorf("got endpoints %+v of followed host, want /posts without title", endpoints)
+	}
+
+	page = PageSearchResult{LinksWithTitle: LinksWithTitle{Link: "/vehicles"}}
+	page.Anchors = []parser.Anchor{{Href: "http://Blog.SpaceX.com/about", Text: "About"}}
+	spacex.MustBegin(db)
+	storePageLinks(spacex, page)
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !blog.EndpointContains(db, "/about") {
+		t.Error("link with another scheme isn't stored for the host with the same host name")
+	}
+	var hosts int
+	db.Get(&hosts, "SELECT COUNT(*) FROM hosts")
+	if hosts != 3 {
+		t.Errorf("got %d hosts, want %d", hosts, 3)
+	}
+	// Followed hosts aren't searched until they are activated
+	var searchable []Host
+	if err := db.Select(&searchable, SelectSearchableHosts); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range searchable {
+		if host.Name == blog.Name {
+			t.Errorf("followed host %s is searchable", host.Name)
+		}
+	}
+
+	var suggestions []HostSuggestion
+	if err := db.Select(&suggestions, SelectHostSuggestions, 10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := []HostSuggestion{{Host: "www.esa.int", Links: 1}}; !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("got suggestions %+v, want %+v", suggestions, want)
+	}
+}
+
+func TestCreateEndpointConcurrently(t *testing.T) {
+	db := newTestDB(t)
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+
+	ids := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := db.Get(&ids[i], "SELECT create_endpoint($1, $2)", spacex.Id, "/vehicles"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("got endpoints %v, want the same endpoint", ids)
+			break
+		}
+	}
+	var endpoints int
+	db.Get(&endpoints, "SELECT COUNT(*) FROM endpoints WHERE host_id=$1", spacex.Id)
+	if endpoints != 1 {
+		t.Errorf("got %d endpoints, want 1", endpoints)
+	}
+}
+
+func TestUpdateHostAuthority(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/", "SpaceX", EndpointMetadata{ContentHash: "h1"})
+	spacex.StoreEndpointLinks("/", []string{"/vehicles", "/launches"}, []string{"Vehicles", "Launches"})
+	spacex.NewEndpoint("/vehicles", "Vehicles", EndpointMetadata{ContentHash: "v1"})
+	spacex.StoreEndpointLinks("/vehicles", []string{"/", "/launches", "/launches"}, []string{"Home", "Launches", "Upcoming launches"})
+	spacex.NewEndpoint("/launches", "Launches", EndpointMetadata{ContentHash: "l1"})
+	spacex.StoreEndpointLinks("/launches", []string{"/"}, []string{"Home"})
+	spacex.NewEndpoint("/careers", "Careers", EndpointMetadata{ContentHash: "c1"})
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var anchors int
+	db.Get(&anchors, "SELECT COUNT(*) FROM links")
+	if anchors != 6 {
+		t.Errorf("got %d links, want %d", anchors, 6)
+	}
+
+	if err := NewRepository(db).UpdateHostAuthority(spacex); err != nil {
+		t.Fatal(err)
+	}
+
+	authority := make(map[string]float64)
+	for _, endpoint := range spacex.GetEndpoints(db) {
+		authority[endpoint.Path] = endpoint.Authority
+	}
+	if authority["/"] != 1 {
+		t.Errorf("got authority of the main page %f, want 1", authority["/"])
+	}
+	if !(authority["/launches"] > authority["/vehicles"] && authority["/vehicles"] > authority["/careers"] && authority["/careers"] > 0) {
+		t.Errorf("got %v, want / > /launches > /vehicles > /careers > 0", authority)
+	}
+}
+
+func TestAnchorText(t *testing.T) {
+	tests := []struct {
+		anchor parser.Anchor
+		want   string
+	}{
+		{anchor: parser.Anchor{Text: "Falcon 9"}, want: "Falcon 9"},
+		{anchor: parser.Anchor{Text: "Falcon 9", Title: "falcon"}, want: "Falcon 9"},
+		{anchor: parser.Anchor{Text: "Falcon 9", Title: "Reusable rocket"}, want: "Falcon 9 Reusable rocket"},
+		{anchor: parser.Anchor{Title: "Upcoming launches"}, want: "Upcoming launches"},
+	}
+
+	for _, test := range tests {
+		if got := anchorText(test.anchor); got != test.want {
+			t.Errorf("%+v: got %q, want %q", test.anchor, got, test.want)
+		}
+	}
+}
+
+func TestGetIncomingAnchors(t *testing.T) {
+	db := newTestDB(t)
+
+	spacex := createTestHost(t, db, "https://www.spacex.com/")
+	spacex.MustBegin(db)
+	spacex.NewEndpoint("/", "SpaceX", EndpointMetadata{ContentHash: "h1"})
+	spacex.StoreEndpointLinks("/", []string{"/", "/vehicles", "/launches"}, []string{"Home", "Rockets", ""})
+	spacex.NewEndpoint("/launches", "Launches", EndpointMetadata{ContentHash: "l1"})
+	spacex.StoreEndpointLinks("/launches", []string{"/vehicles"}, []string{"Falcon 9"})
+	if err := spacex.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := spacex.GetIncomingAnchors(db)
+	for _, anchors := range got {
+		sort.Strings(anchors)
+	}
+	want := map[string][]string{"/vehicles": {"Falcon 9", "Rockets"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCollapseSimilar(t *testing.T) {
+	newHit := func(link string, score float64, fingerprint uint64) SearchHit {
+		return SearchHit{LinksWithTitle: LinksWithTitle{Link: link}, Score: score, simhash: fingerprint}
+	}
+	hits := []SearchHit{
+		newHit("/vehicles?ref=menu", 2, 0b1111_0000),
+		newHit("/vehicles", 3, 0b1111_0001),
+		newHit("/careers", 1, 0b0000_1111),
+		newHit("/vehicles/", 2, 0b1110_0000),
+		newHit("/launches", 1, 0),
+		newHit("/launches?page=2", 1, 0),
+	}
+
+	got := make(map[string]int)
+	var links []string
+	for _, hit := range collapseSimilar(hits, 2) {
+		links = append(links, hit.Link)
+		got[hit.Link] = hit.Similar
+	}
+
+	if want := []string{"/vehicles", "/careers", "/launches", "/launches?page=2"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("got %v, want %v", links, want)
+	}
+	if want := map[string]int{"/vehicles": 2, "/careers": 0, "/launches": 0, "/launches?page=2": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetcherFetch(t *testing.T) {
+	const page = `<html lang="en"><head><title>Vehicles</title></head><body><a href="/falcon-9">Falcon 9</a> and Dragon</body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vehicles":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Last-Modified", "Wed, 01 Mar 2023 10:00:00 GMT")
+			fmt.Fprint(w, page)
+		case "/dragon":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><title>Dragon</title><meta property="og:image" content="/dragon.jpg">`+
+				`<script type="application/ld+json">{"@type":"Product","name":"Dragon"}</script></head></html>`)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(make([]byte, 1024))
+		case "/missing":
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "Not found")
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+
+	t.Run("html", func(t *testing.T) {
+		got, err := fetcher.Fetch(server.URL + "/vehicles")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Document.Title != "Vehicles" || got.Document.Text != "Vehicles Falcon 9 and Dragon" {
+			t.Errorf("got document %+v", got.Document)
+		}
+
+		sum := sha256.Sum256([]byte(page))
+		lastModified := time.Date(2023, time.March, 1, 10, 0, 0, 0, time.UTC)
+		want := EndpointMetadata{
+			StatusCode:    http.StatusOK,
+			ContentType:   "text/html",
+			ContentLength: int64(len(page)),
+			ContentHash:   hex.EncodeToString(sum[:]),
+			LastModified:  &lastModified,
+			Language:      "en",
+			OutboundLinks: 1,
+		}
+		if !reflect.DeepEqual(got.Metadata, want) {
+			t.Errorf("got %+v, want %+v", got.Metadata, want)
+		}
+	})
+
+	t.Run("structured data", func(t *testing.T) {
+		got, err := NewFetcher().Fetch(server.URL + "/dragon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (pq.StringArray{"Product"}); !reflect.DeepEqual(got.Metadata.SchemaTypes, want) {
+			t.Errorf("got schema types %v, want %v", got.Metadata.SchemaTypes, want)
+		}
+		var data parser.StructuredData
+		if err := json.Unmarshal(got.Metadata.StructuredData, &data); err != nil {
+			t.Fatal(err)
+		}
+		if data.OpenGraph["og:image"] != "/dragon.jpg" || len(data.Items) != 1 {
+			t.Errorf("got structured data %+v", data)
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		got, err := fetcher.Fetch(server.URL + "/missing")
+		var fetchError *FetchError
+		if !errors.As(err, &fetchError) || fetchError.Kind != FetchErrorClient || fetchError.StatusCode != http.StatusNotFound {
+			t.Fatalf("got error %v, want client error with status 404", err)
+		}
+		if got.Metadata.StatusCode != http.StatusNotFound || got.Document.Text != "" {
+			t.Errorf("got %+v, want metadata without body", got)
+		}
+	})
+
+	t.Run("not allowed content type", func(t *testing.T) {
+		got, err := fetcher.Fetch(server.URL + "/logo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Metadata.ContentType != "image/png" || got.Metadata.ContentLength != 0 || got.Document.Text != "" {
+			t.Errorf("got %+v, want metadata without body", got)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		truncating := NewFetcher()
+		truncating.MaxBodySize = 50
+		got, err := truncating.Fetch(server.URL + "/vehicles")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Metadata.Truncated || got.Metadata.ContentLength != 50 || got.Document.Title != "Vehicles" {
+			t.Errorf("got %+v, want the first 50 bytes", got)
+		}
+		want := FetchMetrics{Fetched: 1, Truncated: 1, BytesRead: 50, Errors: map[FetchErrorKind]int64{}}
+		if metrics := truncating.Metrics.Snapshot(); !reflect.DeepEqual(metrics, want) {
+			t.Errorf("got metrics %+v, want %+v", metrics, want)
+		}
+	})
+
+	want := FetchMetrics{
+		Fetched:   3,
+		Rejected:  1,
+		BytesRead: int64(len(page)),
+		Errors:    map[FetchErrorKind]int64{FetchErrorClient: 1},
+	}
+	if metrics := fetcher.Metrics.Snapshot(); !reflect.DeepEqual(metrics, want) {
+		t.Errorf("got metrics %+v, want %+v", metrics, want)
+	}
+}
+
+func TestAddStructuredSummaries(t *testing.T) {
+	hits := []SearchHit{
+		{structuredData: JSONData(`{"types":["Article"],"items":[{"@type":"Article","author":{"@type":"Person","name":"Elon"}}],"open_graph":{"og:image":"https://www.spacex.com/dragon.jpg"}}`)},
+		{structuredData: JSONData(`{"types":["Thing"],"items":[{"@type":"Thing"}]}`)},
+		{},
+	}
+	addStructuredSummaries(hits)
+
+	want := &parser.StructuredSummary{Image: "https://www.spacex.com/dragon.jpg", Author: "Elon"}
+	if !reflect.DeepEqual(hits[0].Structured, want) {
+		t.Errorf("got %+v, want %+v", hits[0].Structured, want)
+	}
+	for _, hit := range hits[1:] {
+		if hit.Structured != nil {
+			t.Errorf("got %+v, want no summary", hit.Structured)
+		}
+	}
+}
+
+func TestFetcherAllowsContentType(t *testing.T) {
+	fetcher := NewFetcher()
+	tests := map[string]bool{
+		"":                    true,
+		"text/html":           true,
+		"application/rss+xml": true,
+		"application/ld+json": true,
+		"application/pdf":     true,
+		"image/png":           false,
+		"application/zip":     false,
+		"video/mp4":           false,
+		"application/xml+zip": false,
+		"text/html-sandboxed": false,
+	}
+
+	for mediaType, want := range tests {
+		if got := fetcher.AllowsContentType(mediaType); got != want {
+			t.Errorf("%q: got %v, want %v", mediaType, got, want)
+		}
+	}
+}
+
+func TestFetcherRedirectsAndRetries(t *testing.T) {
+	var busyRequests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/", "/new":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "Falcon 9")
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/gone":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		case "/busy":
+			if atomic.AddInt64(&busyRequests, 1) <= 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "Dragon")
+		case "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+	fetcher.MaxRedirects = 3
+	fetcher.RetryBackoff = time.Millisecond
+
+	t.Run("final url", func(t *testing.T) {
+		got, err := fetcher.Fetch(server.URL + "/old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Metadata.FinalURL != server.URL+"/new" || got.Document.Text != "Falcon 9" {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		got, err := fetcher.Fetch(server.URL + "/busy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Metadata.StatusCode != http.StatusOK || got.Document.Text != "Dragon" {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	errorTests := []struct {
+		name       string
+		url        string
+		kind       FetchErrorKind
+		statusCode int
+	}{
+		{"too many redirects", server.URL + "/loop", FetchErrorRedirect, 0},
+		{"cross host redirect", server.URL + "/away", FetchErrorRedirect, 0},
+		{"soft not found", server.URL + "/gone", FetchErrorSoftNotFound, http.StatusOK},
+		{"rate limited", server.URL + "/limited", FetchErrorRateLimited, http.StatusTooManyRequests},
+	}
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := fetcher.Fetch(test.url)
+			var fetchError *FetchError
+			if !errors.As(err, &fetchError) || fetchError.Kind != test.kind || fetchError.StatusCode != test.statusCode {
+				t.Errorf("got error %v, want %s with status %d", err, test.kind, test.statusCode)
+			}
+		})
+	}
+
+	if metrics := fetcher.Metrics.Snapshot(); metrics.Retried != 2+int64(fetcher.MaxRetries) {
+		t.Errorf("got %d retried requests, want %d", metrics.Retried, 2+fetcher.MaxRetries)
+	}
+
+	t.Run("connection refused", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		_, err := fetcher.Fetch(closed.URL)
+		var fetchError *FetchError
+		if !errors.As(err, &fetchError) || fetchError.Kind != FetchErrorConnection {
+			t.Errorf("got error %v, want connection error", err)
+		}
+	})
+}
+
+func TestFetcherRetryTimeLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	t.Run("retry time", func(t *testing.T) {
+		fetcher := NewFetcher()
+		fetcher.MaxRetryTime = 10 * time.Second
+		start := time.Now()
+		_, err := fetcher.Fetch(server.URL)
+		var fetchError *FetchError
+		if !errors.As(err, &fetchError) || fetchError.Kind != FetchErrorServer {
+			t.Errorf("got error %v, want server error", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("got response after %s, want it without retries", elapsed)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		fetcher := NewFetcher()
+		fetcher.MaxRetryTime = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := fetcher.FetchContext(ctx, server.URL)
+		var fetchError *FetchError
+		if !errors.As(err, &fetchError) || fetchError.Kind != FetchErrorTimeout {
+			t.Errorf("got error %v, want timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("got error after %s, want it when the context is done", elapsed)
+		}
+	})
+}
+
+func TestIsPermanentFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&FetchError{Kind: FetchErrorClient, StatusCode: http.StatusNotFound}, true},
+		{&FetchError{Kind: FetchErrorClient, StatusCode: http.StatusGone}, true},
+		{&FetchError{Kind: FetchErrorSoftNotFound, StatusCode: http.StatusOK}, true},
+		{&FetchError{Kind: FetchErrorServer, StatusCode: http.StatusServiceUnavailable}, false},
+		{&FetchError{Kind: FetchErrorRateLimited, StatusCode: http.StatusTooManyRequests}, false},
+		{&FetchError{Kind: FetchErrorTimeout}, false},
+		{errors.New("other"), false},
+	}
+
+	for _, test := range tests {
+		if got := isPermanentFailure(test.err); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestFetcherRetryDelay(t *testing.T) {
+	fetcher := NewFetcher()
+	fetcher.MaxRetryDelay = 10 * time.Second
+
+	tests := []struct {
+		attempt    int
+		retryAfter string
+		want       time.Duration
+	}{
+		{0, "", time.Second},
+		{2, "", 4 * time.Second},
+		{5, "", 10 * time.Second},
+		{0, "3", 3 * time.Second},
+		{0, "120", 10 * time.Second},
+		{0, "Wed, 01 Mar 2023 10:00:00 GMT", 0},
+		{1, "soon", 2 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := fetcher.retryDelay(test.attempt, test.retryAfter); got != test.want {
+			t.Errorf("attempt %d with Retry-After %q: got %s, want %s", test.attempt, test.retryAfter, got, test.want)
+		}
+	}
+}
+
+func TestFetcherIdentity(t *testing.T) {
+	received := make(map[string]http.Header)
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		received[r.Host] = r.Header.Clone()
+		mutex.Unlock()
+		if r.URL.Path == "/redirect" {
+			// Another host name of the same server
+			http.Redirect(w, r, strings.Replace("http://"+r.Host, "127.0.0.1", "localhost", 1)+"/page", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "Falcon 9")
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	headersFile := filepath.Join(t.TempDir(), "headers.json")
+	if err := os.WriteFile(headersFile, []byte(`{"127.0.0.1": {"cookie": "session=1", "User-Agent": "IntranetBot"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hostHeaders, err := LoadHostHeaders(headersFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := NewFetcher()
+	fetcher.FollowCrossHostRedirects = true
+	fetcher.Identity = CrawlerIdentity{Name: "TestBot/2.0", ContactURL: "https://example.com/bot", From: "bot@example.com"}
+	fetcher.HostHeaders = hostHeaders
+	if _, err := fetcher.Fetch(server.URL + "/redirect"); err != nil {
+		t.Fatal(err)
+	}
+
+	own := received[serverURL.Host]
+	if own.Get("Cookie") != "session=1" || own.Get("User-Agent") != "IntranetBot" || own.Get("From") != "bot@example.com" {
+		t.Errorf("got headers %v, want headers of the host", own)
+	}
+	other := received[strings.Replace(serverURL.Host, "127.0.0.1", "localhost", 1)]
+	if other == nil {
+		t.Fatal("redirect wasn't followed")
+	}
+	if other.Get("Cookie") != "" || other.Get("User-Agent") != "TestBot/2.0 (+https://example.com/bot)" || other.Get("From") != "bot@example.com" {
+		t.Errorf("got headers %v, want headers of the crawler only", other)
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := `User-agent: *
+Disallow: /
+
+# Crawler group shares the rules with another bot
+User-agent: OtherBot
+user-agent: testbot
+Disallow: /private
+Allow: /private/public  # comment
+Disallow: /*.pdf$
+Disallow: /search*q=
+
+User-agent: TestBot
+Disallow: /drafts
+`
+
+	tests := []struct {
+		page string
+		want bool
+	}{
+		{"/", true},
+		{"/private", false},
+		{"/private/data", false},
+		{"/private/public/page", true},
+		{"/drafts/1", false},
+		{"/manifest.pdf", false},
+		{"/manifest.pdf?download=1", true},
+		{"/search?lang=en&q=falcon", false},
+		{"/robots.txt", true},
+	}
+
+	rules := ParseRobots(strings.NewReader(robots), CrawlerIdentity{Name: "TestBot/2.0"}.Token())
+	for _, test := range tests {
+		page, _ := url.Parse(test.page)
+		if got := rules.Allows(page); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.page, got, test.want)
+		}
+	}
+
+	others := ParseRobots(strings.NewReader(robots), "AnotherBot")
+	if page, _ := url.Parse("/vehicles"); others.Allows(page) {
+		t.Errorf("got allowed %s, want rules of * group", page)
+	}
+	if page, _ := url.Parse("/vehicles"); !ParseRobots(strings.NewReader(""), "TestBot").Allows(page) {
+		t.Errorf("got disallowed %s by empty robots.txt", page)
+	}
+}
+
+func TestFetcherRobots(t *testing.T) {
+	var robotsRequests int64
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			atomic.AddInt64(&robotsRequests, 1)
+			userAgent.Store(r.UserAgent())
+			fmt.Fprint(w, "User-agent: TestBot\nDisallow: /private\n")
+		default:
+			fmt.Fprint(w, "Falcon 9")
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+	fetcher.Identity = CrawlerIdentity{Name: "TestBot/2.0", ContactURL: "https://example.com/bot"}
+
+	for _, path := range []string{"/vehicles", "/launches"} {
+		if _, err := fetcher.Fetch(server.URL + path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := fetcher.Fetch(server.URL + "/private/plans")
+	var fetchError *FetchError
+	if !errors.As(err, &fetchError) || fetchError.Kind != FetchErrorRobots {
+		t.Errorf("got error %v, want robots error", err)
+	}
+	if got := atomic.LoadInt64(&robotsRequests); got != 1 {
+		t.Errorf("got %d requests of robots.txt, want it cached", got)
+	}
+	if got := userAgent.Load(); got != "TestBot/2.0 (+https://example.com/bot)" {
+		t.Errorf("got robots.txt requested by %q", got)
+	}
+
+	fetcher.IgnoreRobots = true
+	if _, err := fetcher.Fetch(server.URL + "/private/plans"); err != nil {
+		t.Errorf("got error %v, want robots.txt ignored", err)
+	}
+
+	t.Run("unavailable", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, "Falcon 9")
+		}))
+		defer unavailable.Close()
+
+		fetcher := NewFetcher()
+		fetcher.MaxRetries = 0
+		_, err := fetcher.Fetch(unavailable.URL + "/vehicles")
+		var fetchError *FetchError
+		if !errors.As(err, &fetchError) || fetchError.Kind != FetchErrorRobots {
+			t.Errorf("got error %v, want robots error", err)
+		}
+	})
+}
+
+func TestFetcherCredentials(t *testing.T) {
+	received := make(map[string]http.Header)
+	var mutex sync.Mutex
+	logins := 0
+	expired := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received[r.Host+r.URL.Path] = r.Header.Clone()
+		switch r.URL.Path {
+		case "/login":
+			r.ParseForm()
+			if r.PostForm.Get("user") != "crawler" || r.PostForm.Get("password") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: fmt.Sprint(logins), Path: "/"})
+			http.Redirect(w, r, "/docs", http.StatusSeeOther)
+		case "/redirect":
+			http.Redirect(w, r, strings.Replace("http://"+r.Host, "127.0.0.1", "localhost", 1)+"/page", http.StatusFound)
+		default:
+			if session, err := r.Cookie("session"); err == nil && session.Value == expired {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			fmt.Fprint(w, "Falcon 9")
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	otherHost := strings.Replace(serverURL.Host, "127.0.0.1", "localhost", 1)
+
+	t.Run("not sent to another host", func(t *testing.T) {
+		fetcher := NewFetcher()
+		fetcher.FollowCrossHostRedirects = true
+		if err := fetcher.SetCredential(server.URL+"/", credentials.Credential{Kind: credentials.Bearer, Token: "token"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fetcher.Fetch(server.URL + "/redirect"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := received[serverURL.Host+"/redirect"].Get("Authorization"); got != "Bearer token" {
+			t.Errorf("got Authorization %q on the host of the credential", got)
+		}
+		if got := received[otherHost+"/page"].Get("Authorization"); got != "" {
+			t.Errorf("got Authorization %q on another host", got)
+		}
+	})
+
+	t.Run("not sent with another scheme", func(t *testing.T) {
+		fetcher := NewFetcher()
+		if err := fetcher.SetCredential("https://"+serverURL.Host+"/", credentials.Credential{Kind: credentials.Bearer, Token: "token"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fetcher.Fetch(server.URL + "/http"); err != nil {
+			t.Fatal(err)
+		}
+		if got := received[serverURL.Host+"/http"].Get("Authorization"); got != "" {
+			t.Errorf("got Authorization %q over http for https credential", got)
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		fetcher := NewFetcher()
+		credential := credentials.Credential{
+			Kind:      credentials.Login,
+			LoginURL:  server.URL + "/login",
+			LoginForm: map[string]string{"user": "crawler", "password": "secret"},
+		}
+		if err := fetcher.SetCredential(server.URL+"/", credential); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fetcher.Fetch(server.URL + "/private"); err != nil {
+			t.Fatal(err)
+		}
+		session := received[serverURL.Host+"/private"].Get("Cookie")
+		if session == "" {
+			t.Fatal("got no Cookie of the login session")
+		}
+
+		mutex.Lock()
+		expired = strings.TrimPrefix(session, "session=")
+		mutex.Unlock()
+		page, err := fetcher.Fetch(server.URL + "/expired")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := received[serverURL.Host+"/expired"].Get("Cookie"); got == session || got == "" {
+			t.Errorf("got Cookie %q, want new session after %q expired", got, session)
+		}
+		if page.Document.Text != "Falcon 9" {
+			t.Errorf("got text %q after the session was started again", page.Document.Text)
+		}
+
+		credential.LoginForm["password"] = "wrong"
+		if err := fetcher.SetCredential(server.URL+"/", credential); err == nil {
+			t.Error("got no error for failed login")
+		}
+		if err := fetcher.SetCredential("http://"+otherHost+"/", credential); err != ErrLoginOnAnotherHost {
+			t.Errorf("got error %v, want %v", err, ErrLoginOnAnotherHost)
+		}
+	})
+}
+
+func TestLoadCredentials(t *testing.T) {
+	db := newTestDB(t)
+	intranet := createTestHost(t, db, "https://intranet.local/")
+	createTestHost(t, db, "https://www.spacex.com/")
+
+	cipher, err := credentials.NewCipher(make([]byte, credentials.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := NewRepository(db)
+	repository.Cipher = cipher
+
+	for _, token := range []string{"old", "new"} {
+		secret, err := cipher.Encrypt(credentials.Credential{Kind: credentials.Bearer, Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.MustExec(SetHostCredential, intranet.Name, credentials.Bearer, secret)
+	}
+
+	var stored int
+	if err := db.Get(&stored, "SELECT COUNT(*) FROM credentials"); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 1 {
+		t.Errorf("got %d stored credentials, want the previous one replaced", stored)
+	}
+
+	if err := repository.LoadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	_, intranetLoaded := repository.Fetcher.Credentials.get(&url.URL{Scheme: "https", Host: "intranet.local"})
+	_, spacexLoaded := repository.Fetcher.Credentials.get(&url.URL{Scheme: "https", Host: "www.spacex.com"})
+	if !intranetLoaded || spacexLoaded {
+		t.Error("got credentials of wrong hosts")
+	}
+
+	db.MustExec(DeleteHostCredential, intranet.Name)
+	var credentialId *int
+	if err := db.Get(&credentialId, "SELECT credential_id FROM hosts WHERE name=$1", intranet.Name); err != nil {
+		t.Fatal(err)
+	}
+	if credentialId != nil {
+		t.Errorf("got credential %d after delete", *credentialId)
+	}
+}
+
+func TestFetcherFetchFeed(t *testing.T) {
+	const feed = `<rss><channel><title>Launches</title><item><title>Crew-7</title><link>/launches/crew-7</link></item></channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, feed)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><title>Page</title></html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+	got, err := fetcher.FetchFeed(server.URL+"/feed.xml", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FetchedFeed{
+		Feed: parser.Feed{Title: "Launches", Entries: []parser.FeedEntry{{Link: "/launches/crew-7", Title: "Crew-7"}}},
+		ETag: `"v1"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got, err = fetcher.FetchFeed(server.URL+"/feed.xml", `"v1"`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (FetchedFeed{ETag: `"v1"`, NotModified: true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := fetcher.FetchFeed(server.URL+"/page", "", ""); !errors.Is(err, parser.ErrNotFeed) {
+		t.Errorf("got error %v, want %v", err, parser.ErrNotFeed)
+	}
+	var fetchError *FetchError
+	if _, err := fetcher.FetchFeed(server.URL+"/missing", "", ""); !errors.As(err, &fetchError) || fetchError.StatusCode != http.StatusNotFound {
+		t.Errorf("got error %v, want client error with status 404", err)
+	}
+}
+
+func TestFeedLinks(t *testing.T) {
+	host := Host{Name: "https://www.spacex.com/"}
+	feed := parser.Feed{Entries: []parser.FeedEntry{
+		{Link: "https://www.spacex.com/launches/crew-7"},
+		{Link: "starlink"},
+		{Link: "/launches/crew-7"},
+		{Link: "https://www.nasa.gov/missions/artemis"},
+	}}
+
+	got := feedLinks(host, "/launches/feed.xml", feed)
+	if want := []string{"/launches/crew-7", "/launches/starlink"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	host.ScopeKind, host.ScopeValues = string(ScopePathPrefix), []string{"/launches/starlink"}
+	if got, want := feedLinks(host, "/launches/feed.xml", feed), []string{"/launches/starlink"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetchHostFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/news/feed.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, `<feed><entry><link href="crew-7"/></entry><entry><link href="https://www.nasa.gov/artemis"/></entry></feed>`)
+	}))
+	defer server.Close()
+
+	repository := Repository{Fetcher: NewFetcher()}
+	host := Host{Name: server.URL + "/"}
+	feedPath, fetched, ok := repository.fetchHostFeed(host, "/news/feed.xml")
+	if !ok || feedPath != "/news/feed.xml" {
+		t.Fatalf("got feed %q, %v", feedPath, ok)
+	}
+	if got, want := feedLinks(host, feedPath, fetched.Feed), []string{"/news/crew-7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, _, ok := repository.fetchHostFeed(host, "/missing.xml"); ok {
+		t.Error("got missing feed")
+	}
+	if _, _, ok := repository.fetchHostFeed(host, "https://www.nasa.gov/feed.xml"); ok {
+		t.Error("got feed of another host")
+	}
+}
+
+func TestPollHostFeeds(t *testing.T) {
+	db := newTestDB(t)
+
+	var requested []string
+	var mutex sync.Mutex
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested = append(requested, r.URL.Path)
+		mutex.Unlock()
+		switch r.URL.Path {
+		case "/feed.xml":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, `<feed xmlns="http://www.w3.org/2005/Atom"><title>Launches</title>`+
+				`<entry><link href="/launches/crew-7"/></entry><entry><link href="/launches/starlink"/></entry></feed>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><title>%s</title><body>Launch</body></html>", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	repository := NewRepository(db)
+	repository.Fetcher.Client = server.Client()
+	repository.Fetcher.IgnoreRobots = true
+	host := createTestHost(t, db, server.URL+"/")
+	db.MustExec(ChangeHostsIsSearchableState, host.Name)
+	db.MustExec(AddHostFeed, host.Id, "/feed.xml")
+	host.MustBegin(db)
+	host.NewEndpoint("/launches/crew-7", "Crew-7", EndpointMetadata{ContentHash: "c1"})
+	if err := host.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := repository.PollFeeds(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second poll is answered with 304, so entries are fetched once
+	if want := []string{"/feed.xml", "/launches/starlink", "/feed.xml"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("got requests %v, want %v", requested, want)
+	}
+	if !host.EndpointContains(db, "/launches/starlink") {
+		t.Error("new entry isn't indexed")
+	}
+	feeds, err := host.GetFeeds(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].Title != "Launches" || feeds[0].ETag != `"v1"` || feeds[0].PolledAt == nil {
+		t.Errorf("got feeds %+v", feeds)
+	}
+}
+
+func TestActivateHostsFetchesFeedOnce(t *testing.T) {
+	db := newTestDB(t)
+
+	requested := make(map[string]int)
+	var mutex sync.Mutex
+	site := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested[r.URL.Path]++
+		mutex.Unlock()
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, `<feed xmlns="http://www.w3.org/2005/Atom"><title>Launches</title><entry><link href="/launches/crew-7"/></entry></feed>`)
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><title>SpaceX</title><link rel="alternate" type="application/atom+xml" href="/feed.xml"></head><body>Launches</body></html>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<html><title>%s</title><body>Launch</body></html>", r.URL.Path)
+		}
+	}))
+	defer site.Close()
+
+	repository := NewRepository(db)
+	repository.Fetcher.Client = site.Client()
+	repository.Fetcher.IgnoreRobots = true
+	host := createTestHost(t, db, site.URL+"/")
+
+	router := rou.NewRouter()
+	router.Post("/hosts/activate", repository.ActivateHosts)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/hosts/activate", "application/json", strings.NewReader(`["`+host.Name+`"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", response.StatusCode)
+	}
+
+	if requested["/feed.xml"] != 1 {
+		t.Errorf("got %d requests of the feed, want 1", requested["/feed.xml"])
+	}
+	if !host.EndpointContains(db, "/launches/crew-7") {
+		t.Error("entry of the feed isn't indexed")
+	}
+	feeds, err := host.GetFeeds(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].Title != "Launches" || feeds[0].ETag != `"v1"` || feeds[0].PolledAt == nil {
+		t.Errorf("got feeds %+v, want the feed stored as polled", feeds)
+	}
+}
+
+func TestRequestAndSearchLimitsHostRequests(t *testing.T) {
+	var current, peak int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		running := atomic.AddInt64(&current, 1)
+		defer atomic.AddInt64(&current, -1)
+		for {
+			seen := atomic.LoadInt64(&peak)
+			if running <= seen || atomic.CompareAndSwapInt64(&peak, seen, running) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "Falcon "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	var links []string
+	for i := 0; i < 3*MaxHostRequests; i++ {
+		links = append(links, fmt.Sprintf("/launches/%d", i))
+	}
+	repository := NewRepository(nil)
+	pages, err := requestAndSearch(repository.Fetcher, []string{"falcon"}, server.URL+"/", links, repository.Analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != len(links) {
+		t.Errorf("got %d pages, want %d", len(pages), len(links))
+	}
+	for _, page := range pages {
+		if !page.Found["falcon"] {
+			t.Errorf("%s: phrase isn't found", page.Link)
+		}
+	}
+	if peak := atomic.LoadInt64(&peak); peak > MaxHostRequests {
+		t.Errorf("got %d concurrent requests, want at most %d", peak, MaxHostRequests)
+	}
+}
+
+func TestCrawlLinkedEndpoints(t *testing.T) {
+	db := newTestDB(t)
+
+	var requested []string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested = append(requested, r.URL.Path)
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><title>%s</title><body>Launch</body></html>", r.URL.Path)
+	}))
+	defer server.Close()
+
+	repository := NewRepository(db)
+	repository.Fetcher.IgnoreRobots = true
+	host := createTestHost(t, db, server.URL+"/")
+	db.MustExec(ChangeHostsIsSearchableState, host.Name)
+	inactive := createTestHost(t, db, "http://inactive.example/")
+	for _, linking := range []Host{host, inactive} {
+		linking.MustBegin(db)
+		linking.StoreEndpointLinks("/", []string{"/launches"}, []string{"Launches"})
+		if err := linking.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repository.CrawlLinkedEndpoints(10); err != nil {
+		t.Fatal(err)
+	}
+	// The source of the links isn't crawled either. Endpoints of hosts which aren't searchable aren't crawled
+	sort.Strings(requested)
+	if want := []string{"/", "/launches"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("got requests %v, want %v", requested, want)
+	}
+	for _, endpoint := range host.GetEndpoints(db) {
+		if endpoint.IsLinkedOnly() || endpoint.Title != endpoint.Path {
+			t.Errorf("got %+v, want crawled endpoint", endpoint)
+		}
+	}
+
+	requested = nil
+	if err := repository.CrawlLinkedEndpoints(10); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 0 {
+		t.Errorf("got requests %v of crawled endpoints", requested)
+	}
+}
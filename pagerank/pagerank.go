@@ -0,0 +1,111 @@
+// Package pagerank computes authority of pages by links between them
+package pagerank
+
+import "math"
+
+const (
+	DefaultDamping    = 0.85
+	DefaultIterations = 50
+	DefaultTolerance  = 1e-6
+)
+
+// Graph is a directed graph of pages identified by ids
+type Graph struct {
+	nodes []int
+	index map[int]int
+	edges map[int]map[int]bool
+}
+
+func NewGraph() *Graph {
+	return &Graph{index: make(map[int]int), edges: make(map[int]map[int]bool)}
+}
+
+func (g *Graph) AddNode(id int) {
+	if _, ok := g.index[id]; !ok {
+		g.index[id] = len(g.nodes)
+		g.nodes = append(g.nodes, id)
+	}
+}
+
+// AddEdge adds link from one page to another. Repeated links and links to the page itself are ignored
+func (g *Graph) AddEdge(from int, to int) {
+	g.AddNode(from)
+	g.AddNode(to)
+	if from == to {
+		return
+	}
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[int]bool)
+	}
+	g.edges[from][to] = true
+}
+
+func (g *Graph) Len() int {
+	return len(g.nodes)
+}
+
+// Rank computes PageRank of every page. Ranks sum up to 1, rank of pages without
+// outgoing links is distributed evenly. Iterations stop when ranks change less than tolerance
+func (g *Graph) Rank(damping float64, iterations int, tolerance float64) map[int]float64 {
+	count := len(g.nodes)
+	ranks := make(map[int]float64, count)
+	if count == 0 {
+		return ranks
+	}
+
+	rank := make([]float64, count)
+	for i := range rank {
+		rank[i] = 1 / float64(count)
+	}
+
+	next := make([]float64, count)
+	for iteration := 0; iteration < iterations; iteration++ {
+		var danglingRank float64
+		for i, id := range g.nodes {
+			if len(g.edges[id]) == 0 {
+				danglingRank += rank[i]
+			}
+		}
+
+		base := (1-damping)/float64(count) + damping*danglingRank/float64(count)
+		for i := range next {
+			next[i] = base
+		}
+		for from, targets := range g.edges {
+			share := damping * rank[g.index[from]] / float64(len(targets))
+			for to := range targets {
+				next[g.index[to]] += share
+			}
+		}
+
+		var change float64
+		for i := range rank {
+			change += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if change < tolerance {
+			break
+		}
+	}
+
+	for i, id := range g.nodes {
+		ranks[id] = rank[i]
+	}
+	return ranks
+}
+
+// Normalize scales ranks so the highest one is 1
+func Normalize(ranks map[int]float64) map[int]float64 {
+	var max float64
+	for _, rank := range ranks {
+		max = math.Max(max, rank)
+	}
+
+	normalized := make(map[int]float64, len(ranks))
+	for id, rank := range ranks {
+		if max > 0 {
+			normalized[id] = rank / max
+		}
+	}
+	return normalized
+}
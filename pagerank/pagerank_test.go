@@ -0,0 +1,67 @@
+package pagerank
+
+import (
+	"math"
+	"testing"
+)
+
+func assertRanks(t *testing.T, got map[int]float64, want map[int]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for id, rank := range want {
+		if math.Abs(got[id]-rank) > 1e-4 {
+			t.Errorf("page %d: got %.5f, want %.5f", id, got[id], rank)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	t.Run("empty graph", func(t *testing.T) {
+		if got := NewGraph().Rank(DefaultDamping, DefaultIterations, DefaultTolerance); len(got) != 0 {
+			t.Errorf("got %v, want empty ranks", got)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		graph := NewGraph()
+		graph.AddEdge(1, 2)
+		graph.AddEdge(2, 3)
+		graph.AddEdge(3, 1)
+		assertRanks(t, graph.Rank(DefaultDamping, DefaultIterations, DefaultTolerance), map[int]float64{1: 1.0 / 3, 2: 1.0 / 3, 3: 1.0 / 3})
+	})
+
+	t.Run("hub", func(t *testing.T) {
+		// Every page links to the main page and it links back to the first one
+		graph := NewGraph()
+		graph.AddEdge(1, 2)
+		graph.AddEdge(2, 1)
+		graph.AddEdge(3, 1)
+		graph.AddEdge(3, 1)
+		graph.AddEdge(3, 3)
+		graph.AddNode(4)
+
+		ranks := graph.Rank(DefaultDamping, 100, 1e-9)
+		var sum float64
+		for _, rank := range ranks {
+			sum += rank
+		}
+		if math.Abs(sum-1) > 1e-6 {
+			t.Errorf("ranks sum up to %f, want 1", sum)
+		}
+		if !(ranks[1] > ranks[2] && ranks[2] > ranks[3] && ranks[3] == ranks[4]) {
+			t.Errorf("got %v, want 1 > 2 > 3 = 4", ranks)
+		}
+		// Pages without incoming links get only the random jump and the share of dangling page 4
+		want := (1-DefaultDamping)/4 + DefaultDamping*ranks[4]/4
+		if math.Abs(ranks[3]-want) > 1e-6 {
+			t.Errorf("got %f, want %f", ranks[3], want)
+		}
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	assertRanks(t, Normalize(map[int]float64{1: 0.5, 2: 0.25, 3: 0}), map[int]float64{1: 1, 2: 0.5, 3: 0})
+	assertRanks(t, Normalize(map[int]float64{}), map[int]float64{})
+}
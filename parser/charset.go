@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// DefaultCharset is used for documents which are not valid UTF-8, don't declare their charset and
+// don't look like text in any of SniffedCharsets. HTML standard uses "windows-1252" for such documents
+var DefaultCharset = "windows-1252"
+
+// SniffedCharsets are tried for documents which are not valid UTF-8 and don't declare their charset
+var SniffedCharsets = []string{"windows-1251", "koi8-r", "shift_jis"}
+
+// Number of bytes at the start of the document which are searched for a declared charset
+const charsetPrescanLength = 1024
+
+var byteOrderMarks = []struct {
+	mark    []byte
+	charset string
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8"},
+	{[]byte{0xFE, 0xFF}, "utf-16be"},
+	{[]byte{0xFF, 0xFE}, "utf-16le"},
+}
+
+// DetectCharset returns canonical name of the charset of the document, e.g. "windows-1251".
+// The charset is taken from the byte order mark, charset of the Content-Type header, declaration
+// in the document (<meta charset> or <?xml encoding?>) in this order. Documents without them are
+// UTF-8 if the start is valid UTF-8, otherwise the charset is sniffed from the bytes of the start
+func DetectCharset(contentType string, start []byte) string {
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(start, bom.mark) {
+			return bom.charset
+		}
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if name, ok := charsetName(params["charset"]); ok {
+			return name
+		}
+	}
+
+	if name, ok := charsetName(declaredCharset(start)); ok {
+		// ASCII compatible document can't declare UTF-16, it is read as UTF-8 like browsers do
+		if strings.HasPrefix(name, "utf-16") {
+			return "utf-8"
+		}
+		return name
+	}
+
+	if validUTF8Prefix(start) {
+		return "utf-8"
+	}
+	return sniffCharset(start)
+}
+
+// charsetName returns canonical name of the charset label, e.g. "windows-1251" for "cp1251"
+func charsetName(label string) (string, bool) {
+	if label == "" {
+		return "", false
+	}
+	charsetEncoding, err := htmlindex.Get(strings.TrimSpace(label))
+	if err != nil {
+		return "", false
+	}
+	name, err := htmlindex.Name(charsetEncoding)
+	return name, err == nil
+}
+
+// declaredCharset returns charset from the XML declaration or <meta> tags at the start of the document
+func declaredCharset(start []byte) string {
+	if bytes.HasPrefix(start, []byte("<?xml")) {
+		if end := bytes.Index(start, []byte("?>")); end != -1 {
+			if encoding := findAttribute(string(start[len("<?xml"):end]), "encoding"); encoding != "" {
+				return encoding
+			}
+		}
+	}
+
+	for _, attributes := range findTags(start, "meta") {
+		if strings.EqualFold(findAttribute(attributes, "http-equiv"), "content-type") {
+			if _, params, err := mime.ParseMediaType(findAttribute(attributes, "content")); err == nil && params["charset"] != "" {
+				return params["charset"]
+			}
+			continue
+		}
+		if charset := findAttribute(attributes, "charset"); charset != "" {
+			return charset
+		}
+	}
+	return ""
+}
+
+// validUTF8Prefix reports whether the bytes are valid UTF-8. Character at the end may be cut if
+// the bytes are the prescanned start of a longer document
+func validUTF8Prefix(start []byte) bool {
+	if len(start) < charsetPrescanLength {
+		return utf8.Valid(start)
+	}
+	for cut := 0; cut < utf8.UTFMax; cut++ {
+		if utf8.Valid(start[:len(start)-cut]) {
+			return cut == 0 || !utf8.FullRune(start[len(start)-cut:])
+		}
+	}
+	return false
+}
+
+// decodeReader returns reader of the body transcoded from its charset to UTF-8. Byte order mark is
+// removed, invalid sequences are replaced with U+FFFD
+func decodeReader(contentType string, body *bufio.Reader) *bufio.Reader {
+	// Peek returns less bytes with an error for short bodies, which is fine for detection
+	start, _ := body.Peek(charsetPrescanLength)
+	charset := DetectCharset(contentType, start)
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(start, bom.mark) {
+			body.Discard(len(bom.mark))
+			break
+		}
+	}
+
+	charsetEncoding, err := htmlindex.Get(charset)
+	if err != nil {
+		charsetEncoding = unicode.UTF8
+	}
+	return bufio.NewReader(transform.NewReader(body, charsetEncoding.NewDecoder()))
+}
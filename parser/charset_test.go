@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		start       string
+		want        string
+	}{
+		{"bom", "text/html; charset=windows-1251", "\xEF\xBB\xBF<html>", "utf-8"},
+		{"utf-16 bom", "text/html", "\xFF\xFE<\x00", "utf-16le"},
+		{"header", "text/html; charset=KOI8-R", `<meta charset="utf-8">`, "koi8-r"},
+		{"header alias", "text/html; charset=cp1251", "", "windows-1251"},
+		{"unknown header charset", "text/html; charset=unknown", `<meta charset="shift_jis">`, "shift_jis"},
+		{"meta charset", "text/html", `<html><head><meta charset=windows-1251><title>`, "windows-1251"},
+		{"meta http-equiv", "text/html", `<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS">`, "shift_jis"},
+		{"meta utf-16", "text/html", `<meta charset="utf-16">`, "utf-8"},
+		{"xml declaration", "application/xml", `<?xml version="1.0" encoding="ISO-8859-5"?><rss>`, "iso-8859-5"},
+		{"valid utf-8", "text/plain", "Полёт", "utf-8"},
+		{"cut utf-8 character", "text/plain", ("a" + strings.Repeat("Полёт", 103))[:charsetPrescanLength], "utf-8"},
+		{"undeclared windows-1251", "text/plain", "\xcf\xee\xeb\xb8\xf2", "windows-1251"},
+		{"undeclared koi8-r", "text/html", "<p>\xf2\xc1\xcb\xc5\xd4\xc1 \xd3\xcf\xd5\xda</p>", "koi8-r"},
+		{"undeclared shift_jis", "text/html", "<p>\x89\x46\x92\x88\x82\xcc\x83\x8d\x83\x50\x83\x62\x83\x67</p>", "shift_jis"},
+		{"cut undeclared windows-1251", "text/plain", strings.Repeat("\xcf\xee\xeb\xb8\xf2 ", 200)[:charsetPrescanLength], "windows-1251"},
+		{"latin-1", "text/plain", "Caf\xe9 cr\xe8me br\xfbl\xe9e", "windows-1252"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectCharset(test.contentType, []byte(test.start)); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        Document
+	}{
+		{
+			name:        "windows-1251 from header",
+			contentType: "text/html; charset=windows-1251",
+			// "Полёт" in windows-1251
+			body: "<title>\xcf\xee\xeb\xb8\xf2</title>",
+			want: Document{Title: "Полёт", Text: "Полёт"},
+		},
+		{
+			name:        "koi8-r from meta",
+			contentType: "text/html",
+			// "Ракета" in KOI8-R
+			body: "<meta charset=\"koi8-r\"><title>\xf2\xc1\xcb\xc5\xd4\xc1</title>",
+			want: Document{Title: "Ракета", Text: "Ракета"},
+		},
+		{
+			name:        "shift_jis from http-equiv",
+			contentType: "",
+			// "宇宙" in Shift_JIS
+			body: "<html><meta http-equiv=\"Content-Type\" content=\"text/html; charset=Shift_JIS\"><title>\x89\x46\x92\x88</title></html>",
+			want: Document{Title: "宇宙", Text: "宇宙"},
+		},
+		{
+			name:        "utf-16 with bom",
+			contentType: "text/plain",
+			body:        "\xFF\xFEF\x00a\x00l\x00c\x00o\x00n\x00",
+			want:        Document{Title: "Falcon", Text: "Falcon"},
+		},
+		{
+			name:        "xml declaration",
+			contentType: "application/rss+xml",
+			body:        "<?xml version=\"1.0\" encoding=\"windows-1251\"?><rss><title>\xcf\xee\xeb\xb8\xf2</title></rss>",
+			want:        Document{Title: "Полёт", Text: "Полёт"},
+		},
+		{
+			name:        "undeclared windows-1251",
+			contentType: "text/html",
+			// "Запуск" in windows-1251
+			body: "<html><head><title>\xc7\xe0\xef\xf3\xf1\xea</title></head></html>",
+			want: Document{Title: "Запуск", Text: "Запуск"},
+		},
+		{
+			name:        "default charset",
+			contentType: "text/plain",
+			body:        "Caf\xe9",
+			want:        Document{Title: "Café", Text: "Café"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Extract(test.contentType, []byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != test.want.Title || got.Text != test.want.Text {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
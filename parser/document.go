@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrUnsupportedContentType = errors.New("Unsupported content type")
+
+// Document is a page reduced to the parts which are indexed. Only HTML documents have links,
+// feeds, description and canonical URL
+type Document struct {
+	Title string
+	Text  string
+	// Language declared by the document, e.g. "en-US"
+	Language     string
+	Description  string
+	CanonicalURL string
+	Anchors      []Anchor
+	// Feeds of the page from <link rel="alternate">, e.g. RSS
+	Feeds          []Anchor
+	StructuredData StructuredData
+}
+
+type Extractor func(body []byte) (Document, error)
+
+// Extractors by media type. Types with "+xml" and "+json" suffixes are handled as XML and JSON
+var Extractors = map[string]Extractor{
+	"text/html":             ExtractHTML,
+	"application/xhtml+xml": ExtractHTML,
+	"text/plain":            ExtractPlainText,
+	"application/pdf":       ExtractPDF,
+	"application/xml":       ExtractXML,
+	"text/xml":              ExtractXML,
+	"application/json":      ExtractJSON,
+	"text/json":             ExtractJSON,
+}
+
+// Extractors which read the document while it is downloaded
+var ReaderExtractors = map[string]func(io.Reader) (Document, error){
+	"text/html":             ExtractHTMLReader,
+	"application/xhtml+xml": ExtractHTMLReader,
+}
+
+// Extract returns document from the body by its media type. Type is detected by content if it is
+// empty or "application/octet-stream". ErrUnsupportedContentType is returned for other types
+func Extract(contentType string, body []byte) (Document, error) {
+	return ExtractReader(contentType, bytes.NewReader(body))
+}
+
+// ExtractReader is Extract which reads the body from the reader. Text documents are transcoded to
+// UTF-8 from the charset detected by DetectCharset. Documents supported by ReaderExtractors are
+// extracted without reading the whole body into memory
+func ExtractReader(contentType string, reader io.Reader) (Document, error) {
+	body := bufio.NewReader(reader)
+	mediaType := strings.ToLower(contentType)
+	if parsedType, _, err := mime.ParseMediaType(contentType); err == nil {
+		mediaType = parsedType
+	}
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		// Peek returns less bytes with an error for short bodies, which is fine for detection
+		start, _ := body.Peek(512)
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(start))
+	}
+	if isTextType(mediaType) {
+		body = decodeReader(contentType, body)
+	}
+
+	if readerExtractor, ok := ReaderExtractors[mediaType]; ok {
+		return readerExtractor(body)
+	}
+
+	extractor, ok := Extractors[mediaType]
+	switch {
+	case ok:
+	case strings.HasSuffix(mediaType, "+xml"):
+		extractor = ExtractXML
+	case strings.HasSuffix(mediaType, "+json"):
+		extractor = ExtractJSON
+	default:
+		return Document{}, ErrUnsupportedContentType
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return Document{}, err
+	}
+	return extractor(content)
+}
+
+// isTextType reports whether the documents of the media type are text in some charset
+func isTextType(mediaType string) bool {
+	switch mediaType {
+	case "application/xhtml+xml", "application/xml", "application/json":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+func ExtractHTML(body []byte) (Document, error) {
+	return ExtractHTMLReader(bytes.NewReader(body))
+}
+
+// Maximum length of the title of a plain text document in characters
+const plainTextTitleLength = 100
+
+// ExtractPlainText uses the first non-empty line of the text as its title
+func ExtractPlainText(body []byte) (Document, error) {
+	text := strings.TrimPrefix(string(body), "\uFEFF")
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "\uFFFD")
+	}
+
+	var title string
+	for _, line := range strings.Split(text, "\n") {
+		if title = strings.Join(strings.Fields(line), " "); title != "" {
+			break
+		}
+	}
+	if utf8.RuneCountInString(title) > plainTextTitleLength {
+		title = string([]rune(title)[:plainTextTitleLength]) + "…"
+	}
+
+	return Document{Title: title, Text: strings.Join(strings.Fields(text), " ")}, nil
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        Document
+		shouldFail  bool
+	}{
+		{
+			name:        "html",
+			contentType: "text/html; charset=utf-8",
+			body:        `<html lang="en"><head><title> Vehicles </title></head><body><a href="/falcon-9">Falcon 9</a></body></html>`,
+			want: Document{
+				Title:    "Vehicles",
+				Text:     "Vehicles Falcon 9",
+				Language: "en",
+				Anchors:  []Anchor{{Href: "/falcon-9", Text: "Falcon 9"}},
+			},
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			body:        "\n\n  Launch   manifest \nFalcon 9\tStarlink",
+			want:        Document{Title: "Launch manifest", Text: "Launch manifest Falcon 9 Starlink"},
+		},
+		{
+			name:        "xml by suffix",
+			contentType: "application/rss+xml",
+			body:        `<rss><channel><title>Updates</title><item><title>Launch</title></item></channel></rss>`,
+			want:        Document{Title: "Updates", Text: "Updates Launch"},
+		},
+		{
+			name:        "json",
+			contentType: "application/ld+json",
+			body:        `{"@type": "Article", "headline": "Starship", "author": {"name": "SpaceX"}}`,
+			want:        Document{Title: "Starship", Text: "Article Starship SpaceX"},
+		},
+		{
+			name: "detected by content",
+			body: `<!DOCTYPE html><title>Detected</title>`,
+			want: Document{Title: "Detected", Text: "Detected"},
+		},
+		{
+			name:        "octet stream with text",
+			contentType: "application/octet-stream",
+			body:        "Plain text",
+			want:        Document{Title: "Plain text", Text: "Plain text"},
+		},
+		{name: "image", contentType: "image/png", body: "\x89PNG\r\n\x1a\n", shouldFail: true},
+		{name: "binary", contentType: "application/octet-stream", body: "\x00\x01\x02\x03", shouldFail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Extract(test.contentType, []byte(test.body))
+			if test.shouldFail {
+				if err != ErrUnsupportedContentType {
+					t.Errorf("got %v, want %v", err, ErrUnsupportedContentType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractPlainTextTitle(t *testing.T) {
+	long := ""
+	for i := 0; i < 30; i++ {
+		long += "word "
+	}
+
+	got, _ := ExtractPlainText([]byte("\uFEFF" + long))
+	if want := long[:100] + "…"; got.Title != want {
+		t.Errorf("got %q, want %q", got.Title, want)
+	}
+}
@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Maximum size of a script which is read for embedded data, larger scripts are skipped
+const maxEmbeddedScriptSize = 4 << 20
+
+// Global variables which pages rendered by JavaScript assign their initial state to
+var stateVariables = []string{"__INITIAL_STATE__", "__PRELOADED_STATE__", "__APOLLO_STATE__", "__INITIAL_DATA__"}
+
+// Ids of scripts with JSON state of frameworks, e.g. Next.js
+var stateScriptIds = map[string]bool{"__NEXT_DATA__": true, "__NUXT_DATA__": true}
+
+var (
+	// Keys of values which are links
+	embeddedLinkKeys = map[string]bool{"url": true, "href": true, "link": true, "path": true, "as": true, "@id": true, "permalink": true, "canonical": true}
+	// Keys of values which name the object, they are texts of its link
+	embeddedNameKeys = []string{"name", "title", "headline", "label", "text"}
+	// Keys of values which are identifiers rather than text
+	embeddedSkippedKeys = map[string]bool{"@type": true, "@context": true, "__typename": true, "id": true, "buildid": true, "classname": true, "type": true}
+	// Extensions of links to assets which aren't pages
+	assetExtensions = map[string]bool{".js": true, ".css": true, ".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".ico": true, ".woff": true, ".woff2": true, ".mp4": true, ".json": true, ".map": true}
+)
+
+type embeddedKind int
+
+const (
+	noEmbeddedData embeddedKind = iota
+	// <script type="application/ld+json">
+	linkedData
+	// JSON state of a framework, e.g. <script id="__NEXT_DATA__">
+	stateData
+	// Inline JavaScript which may assign the state to one of stateVariables
+	inlineScript
+)
+
+// embeddedContent is content of a page rendered by JavaScript which is found in its scripts
+type embeddedContent struct {
+	title       string
+	description string
+	texts       []string
+	anchors     []Anchor
+	// Top-level objects of JSON-LD
+	linkedItems []map[string]interface{}
+}
+
+// embeddedScriptKind returns kind of data in the script by its attributes
+func embeddedScriptKind(attributes string) embeddedKind {
+	scriptType := strings.ToLower(findAttribute(attributes, "type"))
+	switch {
+	case scriptType == "application/ld+json":
+		return linkedData
+	case stateScriptIds[findAttribute(attributes, "id")]:
+		return stateData
+	case findAttribute(attributes, "src") != "":
+		return noEmbeddedData
+	case scriptType == "" || scriptType == "text/javascript" || scriptType == "module":
+		return inlineScript
+	}
+	return noEmbeddedData
+}
+
+func (c *embeddedContent) addScript(kind embeddedKind, script []byte) {
+	switch kind {
+	case linkedData, stateData:
+		var value interface{}
+		if json.Unmarshal(bytes.TrimSpace(script), &value) == nil {
+			c.addJSON(value, kind == linkedData)
+		}
+	case inlineScript:
+		for _, variable := range stateVariables {
+			start := bytes.Index(script, []byte(variable))
+			if start == -1 {
+				continue
+			}
+			assignment := bytes.TrimLeft(script[start+len(variable):], " \t\r\n")
+			if !bytes.HasPrefix(assignment, []byte("=")) {
+				continue
+			}
+			// The decoder stops after the first value, so the rest of the script is ignored
+			var value interface{}
+			if json.NewDecoder(bytes.NewReader(assignment[1:])).Decode(&value) == nil {
+				c.addJSON(value, false)
+			}
+		}
+	}
+}
+
+// addJSON collects texts and links of the value. Title and description are taken from the
+// top-level objects of linked data
+func (c *embeddedContent) addJSON(value interface{}, linked bool) {
+	if linked {
+		for _, object := range linkedDataObjects(value) {
+			c.linkedItems = append(c.linkedItems, object)
+			if c.title == "" {
+				c.title = firstString(object, "headline", "name")
+			}
+			if c.description == "" {
+				c.description = firstString(object, "description")
+			}
+		}
+	} else if c.title == "" {
+		c.title = findString(value, "title")
+	}
+	c.walk(value, "")
+}
+
+func (c *embeddedContent) walk(value interface{}, key string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			if href, ok := value[key].(string); ok && embeddedLinkKeys[strings.ToLower(key)] {
+				if isEmbeddedLink(href) {
+					c.anchors = append(c.anchors, Anchor{Href: href, Text: firstString(value, embeddedNameKeys...)})
+				}
+				continue
+			}
+			c.walk(value[key], key)
+		}
+	case []interface{}:
+		for _, item := range value {
+			c.walk(item, key)
+		}
+	case string:
+		minWords := 2
+		if isNameKey(key) {
+			minWords = 1
+		}
+		if !embeddedSkippedKeys[strings.ToLower(key)] && isProse(value, minWords) {
+			if strings.ContainsRune(value, '<') {
+				// Rich text is often stored as HTML
+				if document, err := ExtractHTML([]byte(value)); err == nil {
+					value = document.Text
+				}
+			}
+			c.texts = append(c.texts, value)
+		}
+	}
+}
+
+// Keys are sorted, so texts of the same data are always in the same order
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNameKey(key string) bool {
+	for _, nameKey := range embeddedNameKeys {
+		if strings.EqualFold(key, nameKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkedDataObjects returns top-level objects of JSON-LD: the object itself, items of an array or @graph
+func linkedDataObjects(value interface{}) []map[string]interface{} {
+	var objects []map[string]interface{}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if graph, ok := value["@graph"]; ok {
+			return linkedDataObjects(graph)
+		}
+		objects = append(objects, value)
+	case []interface{}:
+		for _, item := range value {
+			if object, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, object)
+			}
+		}
+	}
+	return objects
+}
+
+// firstString returns the first non-empty string value of the keys
+func firstString(object map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := object[key].(string); ok && strings.TrimSpace(value) != "" {
+			return normalizeSpace(value)
+		}
+	}
+	return ""
+}
+
+// findString returns the string value of the key which is the closest to the root
+func findString(value interface{}, key string) string {
+	level := []interface{}{value}
+	for len(level) > 0 {
+		var next []interface{}
+		for _, value := range level {
+			switch value := value.(type) {
+			case map[string]interface{}:
+				if found := firstString(value, key); found != "" {
+					return found
+				}
+				for _, key := range sortedKeys(value) {
+					next = append(next, value[key])
+				}
+			case []interface{}:
+				next = append(next, value...)
+			}
+		}
+		level = next
+	}
+	return ""
+}
+
+// isEmbeddedLink reports whether the value is a link to a page rather than to an asset
+func isEmbeddedLink(href string) bool {
+	isURL := strings.HasPrefix(href, "https://") || strings.HasPrefix(href, "http://")
+	isPath := strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//")
+	if !(isURL || isPath) || strings.ContainsAny(href, " \t\n") || strings.Contains(href, "/_next/") {
+		return false
+	}
+	linkPath := href
+	if end := strings.IndexAny(linkPath, "?#"); end != -1 {
+		linkPath = linkPath[:end]
+	}
+	return !assetExtensions[strings.ToLower(path.Ext(linkPath))]
+}
+
+// isProse reports whether the string is text for people, which has letters and at least minWords words
+func isProse(value string, minWords int) bool {
+	if len(strings.Fields(value)) < minWords {
+		return false
+	}
+	for _, char := range value {
+		if char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char > 0x7F {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeSpace(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
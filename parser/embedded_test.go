@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const spaPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<link rel="alternate" type="application/rss+xml" title="SpaceX updates" href="/updates.xml">
+	<link rel="alternate" hreflang="de" href="/de/">
+	<script type="application/ld+json">
+	{"@context": "https://schema.org", "@graph": [
+		{"@type": "Organization", "name": "SpaceX", "url": "https://www.spacex.com/", "description": "Designs, manufactures and launches rockets"},
+		{"@type": "WebPage", "name": "Home"}
+	]}
+	</script>
+	<script src="/_next/static/main.js"></script>
+</head>
+<body>
+	<div id="root"></div>
+	<noscript>Enable <a href="/no-js">JavaScript</a> to use the site</noscript>
+	<script id="__NEXT_DATA__" type="application/json">{"buildId": "a1 b2", "page": "/", "props": {"pageProps": {
+		"hero": {"title": "Starship", "body": "<p>Fully <b>reusable</b> transportation</p>"},
+		"links": [{"href": "/vehicles/falcon-9", "label": "Falcon 9"}, {"href": "/_next/data/a1.json"}, {"href": "/logo.svg"}]
+	}}}</script>
+	<script>window.__INITIAL_STATE__ = {"launch": {"name": "Crew-7", "path": "/launches/crew-7", "summary": "Crew launch to the station"}};
+	render();</script>
+</body>
+</html>`
+
+func TestExtractHTMLEmbedded(t *testing.T) {
+	// Values of objects are in order of their keys
+	want := Document{
+		Title:       "SpaceX",
+		Text:        "Enable JavaScript to use the site Designs, manufactures and launches rockets SpaceX Home Fully reusable transportation Starship Falcon 9 Crew-7 Crew launch to the station",
+		Language:    "en",
+		Description: "Designs, manufactures and launches rockets",
+		Anchors: []Anchor{
+			{Href: "/no-js", Text: "JavaScript"},
+			{Href: "https://www.spacex.com/", Text: "SpaceX"},
+			{Href: "/vehicles/falcon-9", Text: "Falcon 9"},
+			{Href: "/launches/crew-7", Text: "Crew-7"},
+		},
+		Feeds: []Anchor{{Href: "/updates.xml", Title: "SpaceX updates"}},
+		StructuredData: StructuredData{
+			Types: []string{"Organization", "WebPage"},
+			Items: []map[string]interface{}{
+				{"@type": "Organization", "name": "SpaceX", "url": "https://www.spacex.com/", "description": "Designs, manufactures and launches rockets"},
+				{"@type": "WebPage", "name": "Home"},
+			},
+		},
+	}
+
+	got, err := ExtractHTML([]byte(spaPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestExtractHTMLEmbeddedTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			name: "title tag is preferred",
+			page: `<title>Vehicles</title><script type="application/ld+json">{"headline": "Falcon 9"}</script>`,
+			want: "Vehicles",
+		},
+		{
+			name: "headline of linked data",
+			page: `<script type="application/ld+json">[{"name": "SpaceX", "headline": "Falcon 9"}]</script>`,
+			want: "Falcon 9",
+		},
+		{
+			name: "the closest title of state",
+			page: `<script id="__NEXT_DATA__" type="application/json">{"a": {"b": {"title": "Deep"}}, "c": {"title": "Launches"}}</script>`,
+			want: "Launches",
+		},
+		{
+			name: "invalid JSON is ignored",
+			page: `<script type="application/ld+json">{"headline": </script><p>Text</p>`,
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExtractHTML([]byte(test.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != test.want {
+				t.Errorf("got title %q, want %q", got.Title, test.want)
+			}
+		})
+	}
+}
+
+func TestReadUntilClosingTag(t *testing.T) {
+	script := `{"title": "Falcon 9"}`
+	got, err := ExtractHTML([]byte(`<script type="application/ld+json">` + strings.Repeat(" ", maxEmbeddedScriptSize) + script + `</script><p>After</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "After" || len(got.Anchors) != 0 {
+		t.Errorf("got %+v, want script larger than the limit skipped", got)
+	}
+}
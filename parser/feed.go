@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrNotFeed = errors.New("Document is not RSS, Atom or JSON feed")
+
+// Feed is the list of recent pages of a site, e.g. news
+type Feed struct {
+	Title   string
+	Entries []FeedEntry
+}
+
+type FeedEntry struct {
+	// Link as it is written in the feed, it may be relative
+	Link  string
+	Title string
+	// Nil when the entry has no date or it isn't recognized
+	Published *time.Time
+}
+
+// Layouts of dates in feeds. RSS uses RFC 822 dates, which are often written with small deviations
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type xmlFeed struct {
+	XMLName xml.Name
+	Title   string `xml:"title"`
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []xmlItem `xml:"item"`
+	} `xml:"channel"`
+	// Items of RSS 1.0 are next to the channel
+	Items []xmlItem `xml:"item"`
+	// Entries of Atom
+	Entries []xmlItem `xml:"entry"`
+}
+
+// xmlItem is RSS item or Atom entry
+type xmlItem struct {
+	Title string    `xml:"title"`
+	Links []xmlLink `xml:"link"`
+	GUID  struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink string `xml:"isPermaLink,attr"`
+	} `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Date      string `xml:"date"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// xmlLink is RSS link with the URL in its text or Atom link with the URL in href
+type xmlLink struct {
+	Href  string `xml:"href,attr"`
+	Rel   string `xml:"rel,attr"`
+	Value string `xml:",chardata"`
+}
+
+type jsonFeed struct {
+	Title string `json:"title"`
+	Items []struct {
+		URL           string `json:"url"`
+		ExternalURL   string `json:"external_url"`
+		Title         string `json:"title"`
+		DatePublished string `json:"date_published"`
+		DateModified  string `json:"date_modified"`
+	} `json:"items"`
+}
+
+// ParseFeed reads RSS 2.0, RSS 1.0, Atom or JSON feed. Charset is detected like for pages, by the
+// content type and declaration in the document
+func ParseFeed(contentType string, reader io.Reader) (Feed, error) {
+	body := decodeReader(contentType, bufio.NewReader(reader))
+	for {
+		char, err := body.ReadByte()
+		if err != nil {
+			return Feed{}, ErrNotFeed
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(char)) {
+			body.UnreadByte()
+			if char == '{' {
+				return parseJSONFeed(body)
+			}
+			return parseXMLFeed(body)
+		}
+	}
+}
+
+func parseXMLFeed(body io.Reader) (Feed, error) {
+	decoder := xml.NewDecoder(body)
+	decoder.Strict = false
+	// The body is already decoded to UTF-8
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var raw xmlFeed
+	if err := decoder.Decode(&raw); err != nil {
+		return Feed{}, err
+	}
+
+	var feed Feed
+	var items []xmlItem
+	switch raw.XMLName.Local {
+	case "rss", "RDF":
+		feed.Title = raw.Channel.Title
+		items = append(raw.Channel.Items, raw.Items...)
+	case "feed":
+		feed.Title = raw.Title
+		items = raw.Entries
+	default:
+		return Feed{}, ErrNotFeed
+	}
+
+	feed.Title = normalizeSpace(feed.Title)
+	for _, item := range items {
+		entry := FeedEntry{Link: item.link(), Title: normalizeSpace(item.Title)}
+		if entry.Link == "" {
+			continue
+		}
+		for _, date := range []string{item.Published, item.PubDate, item.Date, item.Updated} {
+			if entry.Published = parseFeedDate(date); entry.Published != nil {
+				break
+			}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
+
+// link returns the link of RSS item, Atom link to the alternate page or permanent GUID
+func (item xmlItem) link() string {
+	for _, link := range item.Links {
+		switch {
+		case link.Href == "" && strings.TrimSpace(link.Value) != "":
+			return strings.TrimSpace(link.Value)
+		case link.Href != "" && (link.Rel == "" || link.Rel == "alternate"):
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	if item.GUID.IsPermaLink != "false" && strings.HasPrefix(strings.TrimSpace(item.GUID.Value), "http") {
+		return strings.TrimSpace(item.GUID.Value)
+	}
+	return ""
+}
+
+func parseJSONFeed(body io.Reader) (Feed, error) {
+	var raw jsonFeed
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return Feed{}, err
+	}
+
+	feed := Feed{Title: normalizeSpace(raw.Title)}
+	for _, item := range raw.Items {
+		entry := FeedEntry{Link: item.URL, Title: normalizeSpace(item.Title)}
+		if entry.Link == "" {
+			entry.Link = item.ExternalURL
+		}
+		if entry.Link == "" {
+			continue
+		}
+		if entry.Published = parseFeedDate(item.DatePublished); entry.Published == nil {
+			entry.Published = parseFeedDate(item.DateModified)
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
+
+func parseFeedDate(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	for _, layout := range feedDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			date = date.UTC()
+			return &date
+		}
+	}
+	return nil
+}
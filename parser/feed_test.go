@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	published := time.Date(2023, time.August, 26, 7, 27, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		contentType string
+		feed        string
+		want        Feed
+	}{
+		{
+			name:        "rss",
+			contentType: "application/rss+xml",
+			feed: `<?xml version="1.0"?><rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+				<title>SpaceX  Updates</title><atom:link href="https://www.spacex.com/feed.xml" rel="self"/>
+				<item><title>Crew-7</title><link>https://www.spacex.com/launches/crew-7</link><pubDate>Sat, 26 Aug 2023 07:27:00 +0000</pubDate></item>
+				<item><title>Starlink</title><guid>https://www.spacex.com/launches/starlink</guid><pubDate>yesterday</pubDate></item>
+				<item><title>No link</title><guid isPermaLink="false">42</guid></item>
+			</channel></rss>`,
+			want: Feed{Title: "SpaceX Updates", Entries: []FeedEntry{
+				{Link: "https://www.spacex.com/launches/crew-7", Title: "Crew-7", Published: &published},
+				{Link: "https://www.spacex.com/launches/starlink", Title: "Starlink"},
+			}},
+		},
+		{
+			name: "rss 1.0",
+			feed: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+				<channel><title>Launches</title></channel>
+				<item><title>Crew-7</title><link>/launches/crew-7</link><dc:date>2023-08-26T07:27:00Z</dc:date></item>
+			</rdf:RDF>`,
+			want: Feed{Title: "Launches", Entries: []FeedEntry{
+				{Link: "/launches/crew-7", Title: "Crew-7", Published: &published},
+			}},
+		},
+		{
+			name:        "atom",
+			contentType: "application/atom+xml",
+			feed: `<feed xmlns="http://www.w3.org/2005/Atom"><title>SpaceX</title>
+				<entry><title>Crew-7</title><link rel="edit" href="/edit/1"/><link href="/launches/crew-7"/><published>2023-08-26T07:27:00Z</published></entry>
+				<entry><title>Starlink</title><link rel="alternate" href="/launches/starlink"/><updated>2023-08-26T07:27:00Z</updated></entry>
+			</feed>`,
+			want: Feed{Title: "SpaceX", Entries: []FeedEntry{
+				{Link: "/launches/crew-7", Title: "Crew-7", Published: &published},
+				{Link: "/launches/starlink", Title: "Starlink", Published: &published},
+			}},
+		},
+		{
+			name:        "json feed",
+			contentType: "application/feed+json",
+			feed: ` {"version": "https://jsonfeed.org/version/1.1", "title": "SpaceX", "items": [
+				{"id": "1", "url": "/launches/crew-7", "title": "Crew-7", "date_published": "2023-08-26T07:27:00Z"},
+				{"id": "2", "content_text": "No link"}
+			]}`,
+			want: Feed{Title: "SpaceX", Entries: []FeedEntry{
+				{Link: "/launches/crew-7", Title: "Crew-7", Published: &published},
+			}},
+		},
+		{
+			name:        "declared charset",
+			contentType: "application/rss+xml",
+			feed:        "<?xml version=\"1.0\" encoding=\"windows-1251\"?><rss><channel><title>\xcd\xee\xe2\xee\xf1\xf2\xe8</title><item><link>/news/1</link></item></channel></rss>",
+			want:        Feed{Title: "Новости", Entries: []FeedEntry{{Link: "/news/1"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseFeed(test.contentType, strings.NewReader(test.feed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", `<html><title>Page</title></html>`, `<rss><channel>`} {
+		if _, err := ParseFeed("", strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
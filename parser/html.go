@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"io"
+	"strings"
+)
+
+// Text collected from a part of the document, e.g. title or text of a link
+type htmlText struct {
+	strings.Builder
+	open bool
+}
+
+func (t *htmlText) String() string {
+	return strings.Join(strings.Fields(html.UnescapeString(t.Builder.String())), " ")
+}
+
+// ExtractHTMLReader extracts HTML document in one pass over the reader without keeping its
+// markup in memory. Only the text, title and texts of links are accumulated
+func ExtractHTMLReader(reader io.Reader) (Document, error) {
+	page := bufio.NewReader(reader)
+	var document Document
+	var text, title, anchorText htmlText
+	var anchor *Anchor
+	var embedded embeddedContent
+	var microdata microdataParser
+	titleFound := false
+
+	write := func(char byte) {
+		text.WriteByte(char)
+		microdata.write(char)
+		if title.open {
+			title.WriteByte(char)
+		}
+		if anchor != nil {
+			anchorText.WriteByte(char)
+		}
+	}
+	closeAnchor := func() {
+		if anchor != nil {
+			anchor.Text = anchorText.String()
+			document.Anchors = append(document.Anchors, *anchor)
+			anchor = nil
+			anchorText.Reset()
+		}
+	}
+
+	var err error
+	for {
+		var char byte
+		char, err = page.ReadByte()
+		if err != nil {
+			break
+		}
+		if char != '<' {
+			write(char)
+			continue
+		}
+
+		if start, _ := page.Peek(3); string(start) == "!--" {
+			page.Discard(3)
+			if err = skipComment(page); err != nil {
+				break
+			}
+			continue
+		}
+
+		var tag []byte
+		tag, err = page.ReadBytes('>')
+		if err != nil {
+			break
+		}
+		name, attributes := splitTag(tag[:len(tag)-1])
+		write(' ')
+		if strings.HasPrefix(name, "/") {
+			microdata.closeTag(name[1:])
+		} else {
+			microdata.openTag(name, attributes)
+		}
+
+		switch name {
+		case "script":
+			if kind := embeddedScriptKind(attributes); kind != noEmbeddedData {
+				var script []byte
+				if script, err = readUntilClosingTag(page, name, maxEmbeddedScriptSize); script != nil {
+					embedded.addScript(kind, script)
+				}
+			} else {
+				err = skipUntilClosingTag(page, name)
+			}
+		case "style", "template":
+			err = skipUntilClosingTag(page, name)
+		case "title":
+			title.open = !titleFound
+		case "/title":
+			if title.open {
+				title.open, titleFound = false, true
+			}
+		case "html":
+			if document.Language == "" {
+				document.Language = findAttribute(attributes, "lang")
+			}
+		case "meta":
+			document.StructuredData.addMeta(attributes)
+			if document.Description == "" && strings.EqualFold(findAttribute(attributes, "name"), "description") {
+				document.Description = strings.Join(strings.Fields(html.UnescapeString(findAttribute(attributes, "content"))), " ")
+			}
+		case "link":
+			rel := strings.ToLower(findAttribute(attributes, "rel"))
+			if document.CanonicalURL == "" && rel == "canonical" {
+				document.CanonicalURL = html.UnescapeString(findAttribute(attributes, "href"))
+			}
+			if rel == "alternate" && isFeedType(findAttribute(attributes, "type")) {
+				title := strings.Join(strings.Fields(html.UnescapeString(findAttribute(attributes, "title"))), " ")
+				document.Feeds = append(document.Feeds, Anchor{Href: html.UnescapeString(findAttribute(attributes, "href")), Title: title})
+			}
+		case "a":
+			closeAnchor()
+			if href := html.UnescapeString(findAttribute(attributes, "href")); isNavigableLink(href) {
+				title := strings.Join(strings.Fields(html.UnescapeString(findAttribute(attributes, "title"))), " ")
+				anchor = &Anchor{Href: href, Title: title}
+			}
+		case "/a":
+			closeAnchor()
+		}
+		if err != nil {
+			break
+		}
+	}
+	closeAnchor()
+
+	document.Title = title.String()
+	document.Text = text.String()
+	// Pages rendered by JavaScript have their content in scripts
+	if document.Title == "" {
+		document.Title = embedded.title
+	}
+	if document.Description == "" {
+		document.Description = embedded.description
+	}
+	if len(embedded.texts) > 0 {
+		document.Text = strings.TrimSpace(document.Text + " " + normalizeSpace(strings.Join(embedded.texts, " ")))
+	}
+	document.Anchors = append(document.Anchors, embedded.anchors...)
+	for _, item := range append(embedded.linkedItems, microdata.items...) {
+		document.StructuredData.addItem(item)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return document, err
+}
+
+// splitTag returns lowercased name of the tag, e.g. "a" or "/a", and its attributes
+func splitTag(tag []byte) (string, string) {
+	tag = bytes.TrimSuffix(tag, []byte("/"))
+	end := bytes.IndexFunc(tag, func(char rune) bool { return char < 0x80 && isSpace(byte(char)) })
+	if end == -1 {
+		end = len(tag)
+	}
+	return strings.ToLower(string(tag[:end])), string(tag[end:])
+}
+
+func skipComment(page *bufio.Reader) error {
+	dashes := 0
+	for {
+		char, err := page.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case char == '-':
+			dashes++
+		case char == '>' && dashes >= 2:
+			return nil
+		default:
+			dashes = 0
+		}
+	}
+}
+
+// skipUntilClosingTag skips contents of the element which are not HTML, e.g. scripts
+func skipUntilClosingTag(page *bufio.Reader, name string) error {
+	_, err := readUntilClosingTag(page, name, 0)
+	return err
+}
+
+// readUntilClosingTag returns contents of the element which are not HTML. Contents larger than
+// limit are skipped and nil is returned
+func readUntilClosingTag(page *bufio.Reader, name string, limit int) ([]byte, error) {
+	closing := "</" + name
+	var contents []byte
+	matched := 0
+	for matched < len(closing) {
+		char, err := page.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if len(contents) <= limit {
+			contents = append(contents, char)
+		}
+		if char >= 'A' && char <= 'Z' {
+			char += 'a' - 'A'
+		}
+		switch {
+		case char == closing[matched]:
+			matched++
+		case char == '<':
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	if _, err := page.ReadBytes('>'); err != nil {
+		return nil, err
+	}
+	if len(contents) > limit {
+		return nil, nil
+	}
+	return contents[:len(contents)-len(closing)], nil
+}
+
+// isFeedType reports whether the media type of alternate link is RSS, Atom or JSON feed
+func isFeedType(mediaType string) bool {
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case "application/rss+xml", "application/atom+xml", "application/feed+json":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const page = `<!DOCTYPE html>
+<html lang="en-US">
+<head>
+	<title>SpaceX &amp; Vehicles</title>
+	<meta charset="utf-8">
+	<meta name="description" content="Falcon   9 and Dragon">
+	<link rel="canonical" href="https://www.spacex.com/vehicles/">
+	<style>a > b { color: red }</style>
+	<script>if (a < b && "</p>") {}</SCRIPT >
+</head>
+<body>
+	<!-- <a href="/hidden">Hidden</a> -- -->
+	<nav><a href="/" title="Home page">SpaceX</a> <a href="#main">Skip</a></nav>
+	<h1>Falcon <b>9</b></h1>
+	<p>First orbital class <a href=/reuse>reusable<br/>rocket</A>.</p>
+	<template><p>Template</p></template>
+	<a href="/careers">Careers
+</body>
+</html>`
+
+func TestExtractHTMLReader(t *testing.T) {
+	want := Document{
+		Title:        "SpaceX & Vehicles",
+		Text:         "SpaceX & Vehicles SpaceX Skip Falcon 9 First orbital class reusable rocket . Careers",
+		Language:     "en-US",
+		Description:  "Falcon 9 and Dragon",
+		CanonicalURL: "https://www.spacex.com/vehicles/",
+		Anchors: []Anchor{
+			{Href: "/", Text: "SpaceX", Title: "Home page"},
+			{Href: "/reuse", Text: "reusable rocket"},
+			{Href: "/careers", Text: "Careers"},
+		},
+	}
+
+	got, err := ExtractHTMLReader(iotest.OneByteReader(strings.NewReader(page)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	// The same as extraction from the whole page
+	if text := ExtractText([]byte(page)); got.Text != text {
+		t.Errorf("got text %q, ExtractText returns %q", got.Text, text)
+	}
+}
+
+// Pages which are read by small chunks give the same documents as whole pages, including
+// tags, comments and scripts which are split between reads
+func TestExtractHTMLEntryPoints(t *testing.T) {
+	pages := map[string]string{
+		"page":              page,
+		"unclosed comment":  "<title>Falcon</title><p>Dragon<!-- <p>Hidden",
+		"unclosed script":   "<p>Falcon</p><script>var a = '</p>';",
+		"uppercase tags":    "<HTML LANG=ru><TITLE>Запуск</TITLE><A HREF='/launch'>Старт</A></HTML>",
+		"entities":          "<title>R&amp;D &lt;test&gt;</title><p>&copy; 2023&nbsp;SpaceX</p>",
+		"attributes with >": `<a href="/a" title="x > y">Link</a><meta name="description" content="a > b">`,
+	}
+
+	for name, page := range pages {
+		t.Run(name, func(t *testing.T) {
+			whole, err := ExtractHTML([]byte(page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, reader := range []io.Reader{iotest.OneByteReader(strings.NewReader(page)), iotest.HalfReader(strings.NewReader(page))} {
+				streamed, err := ExtractHTMLReader(reader)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(streamed, whole) {
+					t.Errorf("got %+v\nwhole page %+v", streamed, whole)
+				}
+			}
+
+			content := []byte(page)
+			helpers := map[string][2]interface{}{
+				"ExtractText":        {ExtractText(content), whole.Text},
+				"ExtractTitle":       {ExtractTitle(content), whole.Title},
+				"ExtractDescription": {ExtractDescription(content), whole.Description},
+				"ExtractCanonical":   {ExtractCanonical(content), whole.CanonicalURL},
+				"ExtractLanguage":    {ExtractLanguage(content), whole.Language},
+				"ExtractAnchors":     {ExtractAnchors(content), whole.Anchors},
+			}
+			for helper, values := range helpers {
+				if !reflect.DeepEqual(values[0], values[1]) {
+					t.Errorf("%s returns %+v, the document has %+v", helper, values[0], values[1])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractHTMLReaderError(t *testing.T) {
+	readError := errors.New("connection reset")
+	reader := io.MultiReader(strings.NewReader("<title>Partial</title><p>Text"), iotest.ErrReader(readError))
+
+	got, err := ExtractHTMLReader(reader)
+	if err != readError {
+		t.Errorf("got %v, want %v", err, readError)
+	}
+	if got.Title != "Partial" || got.Text != "Partial Text" {
+		t.Errorf("got %+v, want text read before the error", got)
+	}
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Keys of the top-level object which are used as the title of JSON document
+var jsonTitleKeys = []string{"title", "name", "headline"}
+
+type jsonContainer struct {
+	object    bool
+	expectKey bool
+	key       string
+}
+
+// ExtractJSON returns all string values in order of their appearance. Keys are not indexed
+func ExtractJSON(body []byte) (Document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	var document Document
+	var values []string
+	titles := make(map[string]string)
+
+	var containers []jsonContainer
+	// Marks the end of a value, so the next string of an object is a key
+	valueDone := func() {
+		if len(containers) > 0 && containers[len(containers)-1].object {
+			containers[len(containers)-1].expectKey = true
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF && len(containers) > 0 {
+			return document, io.ErrUnexpectedEOF
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return document, err
+		}
+
+		switch token := token.(type) {
+		case json.Delim:
+			switch token {
+			case '{', '[':
+				containers = append(containers, jsonContainer{object: token == '{', expectKey: token == '{'})
+			default:
+				containers = containers[:len(containers)-1]
+				valueDone()
+			}
+		case string:
+			if len(containers) > 0 {
+				top := &containers[len(containers)-1]
+				if top.object && top.expectKey {
+					top.key, top.expectKey = token, false
+					continue
+				}
+				if len(containers) == 1 && top.object && titles[top.key] == "" {
+					titles[top.key] = token
+				}
+			}
+			values = append(values, token)
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+
+	for _, key := range jsonTitleKeys {
+		if title := titles[key]; title != "" {
+			document.Title = strings.Join(strings.Fields(title), " ")
+			break
+		}
+	}
+	document.Text = strings.Join(strings.Fields(strings.Join(values, " ")), " ")
+	return document, nil
+}
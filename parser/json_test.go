@@ -0,0 +1,46 @@
+package parser
+
+import "testing"
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		title string
+		text  string
+	}{
+		{
+			name:  "nested values in order",
+			json:  `{"id": 1, "name": "Falcon 9", "stages": [{"name": "First stage", "engines": 9}, {"name": "Second stage"}], "active": true, "title": null}`,
+			title: "Falcon 9",
+			text:  "Falcon 9 First stage Second stage",
+		},
+		{
+			name:  "title is preferred and nested keys are ignored",
+			json:  `{"rocket": {"title": "Nested"}, "name": "Starship", "title": "Starship  Flight Test"}`,
+			title: "Starship Flight Test",
+			text:  "Nested Starship Starship Flight Test",
+		},
+		{
+			name: "array of strings",
+			json: `["launch", "landing"]`,
+			text: "launch landing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExtractJSON([]byte(test.json))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != test.title || got.Text != test.text {
+				t.Errorf("got %q, %q, want %q, %q", got.Title, got.Text, test.title, test.text)
+			}
+		})
+	}
+
+	if _, err := ExtractJSON([]byte(`{"name": `)); err == nil {
+		t.Error("expected error for invalid document")
+	}
+}
@@ -0,0 +1,70 @@
+package parser
+
+import "strings"
+
+// ExtractLanguage returns value of the "lang" attribute of the "html" tag, e.g. "en-US"
+func ExtractLanguage(html []byte) string {
+	return extractPage(html).Language
+}
+
+// findAttribute returns value of the attribute with quoted or unquoted value
+func findAttribute(attributes string, name string) string {
+	lowerAttributes := strings.ToLower(attributes)
+	for offset := 0; offset < len(attributes); {
+		index := strings.Index(lowerAttributes[offset:], name)
+		if index == -1 {
+			return ""
+		}
+		index += offset
+		offset = index + len(name)
+
+		if index > 0 && !isSpace(attributes[index-1]) {
+			continue
+		}
+		rest := strings.TrimLeft(attributes[offset:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		if rest == "" {
+			return ""
+		}
+
+		if quote := rest[0]; quote == '"' || quote == '\'' {
+			if end := strings.IndexByte(rest[1:], quote); end != -1 {
+				return strings.TrimSpace(rest[1 : end+1])
+			}
+			return ""
+		}
+		if end := strings.IndexAny(rest, " \t\r\n"); end != -1 {
+			return rest[:end]
+		}
+		return rest
+	}
+	return ""
+}
+
+// hasAttribute reports whether the attribute is set, including boolean attributes without value
+func hasAttribute(attributes string, name string) bool {
+	lowerAttributes := strings.ToLower(attributes)
+	for offset := 0; offset < len(attributes); {
+		index := strings.Index(lowerAttributes[offset:], name)
+		if index == -1 {
+			return false
+		}
+		index += offset
+		offset = index + len(name)
+
+		if index > 0 && !isSpace(attributes[index-1]) {
+			continue
+		}
+		if offset == len(attributes) || isSpace(attributes[offset]) || attributes[offset] == '=' || attributes[offset] == '/' {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\r' || char == '\n'
+}
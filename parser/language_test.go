@@ -0,0 +1,27 @@
+package parser
+
+import "testing"
+
+func TestExtractLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{name: "double quotes", html: `<!DOCTYPE html><html lang="en-US"><head></head></html>`, want: "en-US"},
+		{name: "single quotes and other attributes", html: `<HTML class='no-js' LANG='ru'><body></body></HTML>`, want: "ru"},
+		{name: "unquoted value", html: `<html dir=ltr lang=de><body></body></html>`, want: "de"},
+		{name: "xml:lang is not lang", html: `<html xml:lang="fr"><body></body></html>`, want: ""},
+		{name: "no lang attribute", html: `<html><body lang="en"></body></html>`, want: ""},
+		{name: "no html tag", html: `<p>Hello</p>`, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ExtractLanguage([]byte(test.html))
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
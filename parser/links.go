@@ -2,46 +2,48 @@ package parser
 
 import "strings"
 
+// ExtractLinks returns unique hrefs of links to pages of the same host
 func ExtractLinks(html []byte) []string {
-	var startIndex int
-	var links []string // parse attributes from tags 'a'
-
-	for index, char := range html {
-		if char == '<' && html[index+1] == 'a' && html[index+2] == ' ' {
-			startIndex = index + 2
-		} else if char == '>' && startIndex > 0 {
-			links = append(links, string(html[startIndex:index]))
-			startIndex = 0
+	uniqueLinks := make(map[string]bool)
+	var links []string
+	for _, anchor := range ExtractAnchors(html) {
+		link := anchor.Href
+		if !uniqueLinks[link] && strings.Index(link, "https:") == -1 && strings.Index(link, "http:") == -1 {
+			uniqueLinks[link] = true
+			links = append(links, link)
 		}
 	}
+	return links
+}
 
+// CountLinks returns number of unique links including links to other hosts
+func CountLinks(anchors []Anchor) int {
 	uniqueLinks := make(map[string]bool)
-	var parsedData []string
-	for _, attributes := range links {
-		link := findLink(attributes)
-		if link != "" && !uniqueLinks[link] && link != "#" && strings.Index(link, "https:") == -1 && strings.Index(link, "http:") == -1 {
-			uniqueLinks[link] = true
-			parsedData = append(parsedData, link)
-		}
+	for _, anchor := range anchors {
+		uniqueLinks[anchor.Href] = true
 	}
+	return len(uniqueLinks)
+}
+
+type Anchor struct {
+	Href string
+	Text string
+	// Value of the "title" attribute of the link
+	Title string
+}
 
-	return parsedData
+// ExtractAnchors returns links of the page with their visible text and title. Fragments,
+// "javascript:", "mailto:" and "tel:" links are skipped
+func ExtractAnchors(page []byte) []Anchor {
+	return extractPage(page).Anchors
 }
 
-func findLink(attributes string) string {
-	var startIndex int
-	for i, char := range attributes {
-		if char == ' ' {
-			startIndex = i + 1
-		} else if char == '=' && attributes[startIndex:i] == "href" {
-			hrefIndex := i + 2
-			var link []byte
-			for attributes[hrefIndex] != attributes[i+1] {
-				link = append(link, attributes[hrefIndex])
-				hrefIndex++
-			}
-			return string(link)
+func isNavigableLink(href string) bool {
+	lowerHref := strings.ToLower(href)
+	for _, prefix := range []string{"#", "javascript:", "mailto:", "tel:"} {
+		if strings.HasPrefix(lowerHref, prefix) {
+			return false
 		}
 	}
-	return ""
+	return href != ""
 }
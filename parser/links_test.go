@@ -441,3 +441,42 @@ func BenchmarkExtractLinks(b *testing.B) {
 		</body></html>`))
 	}
 }
+
+func TestCountLinks(t *testing.T) {
+	html := `<nav>
+		<a href="/vehicles">Vehicles</a>
+		<a class="active" href="/launches">Launches</a>
+		<a href="/vehicles">Vehicles again</a>
+		<A HREF='https://www.nasa.gov/'>NASA</A>
+		<a href="#top">Top</a>
+		<a href="javascript:void(0)">Menu</a>
+		<a name="anchor">No link</a>
+		<abbr href="/abbr">Not a link</abbr>
+	</nav>`
+
+	if got := CountLinks(ExtractAnchors([]byte(html))); got != 3 {
+		t.Errorf("got %d, want %d", got, 3)
+	}
+}
+
+func TestExtractAnchors(t *testing.T) {
+	html := `<nav>
+		<a href="/vehicles"><span>Falcon</span> 9</a>
+		<a
+			class="external" href='https://www.nasa.gov/?a=1&amp;b=2'>NASA</A>
+		<a href="#top">Top</a>
+		<a href="mailto:media@spacex.com">Email</a>
+		<abbr href="/abbr">Not a link</abbr>
+		<a href="/launches" title="Upcoming  launches"><img src="/rocket.png"></a>
+		<a href="/careers">Careers`
+
+	want := []Anchor{
+		{Href: "/vehicles", Text: "Falcon 9"},
+		{Href: "https://www.nasa.gov/?a=1&b=2", Text: "NASA"},
+		{Href: "/launches", Text: "", Title: "Upcoming launches"},
+		{Href: "/careers", Text: "Careers"},
+	}
+	if got := ExtractAnchors([]byte(html)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
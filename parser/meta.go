@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ExtractDescription returns content of <meta name="description">
+func ExtractDescription(page []byte) string {
+	return extractPage(page).Description
+}
+
+// ExtractCanonical returns href of <link rel="canonical">
+func ExtractCanonical(page []byte) string {
+	return extractPage(page).CanonicalURL
+}
+
+// findTags returns attributes of all opening tags with the name
+func findTags(page []byte, name string) []string {
+	var tags []string
+	lowerPage := bytes.ToLower(page)
+	opening := []byte("<" + name)
+
+	for offset := 0; offset < len(page); {
+		start := bytes.Index(lowerPage[offset:], opening)
+		if start == -1 {
+			break
+		}
+		start += offset + len(opening)
+		offset = start
+		if start >= len(page) || !(isSpace(page[start]) || page[start] == '/' || page[start] == '>') {
+			continue
+		}
+
+		end := bytes.IndexByte(page[start:], '>')
+		if end == -1 {
+			break
+		}
+		tags = append(tags, strings.TrimSuffix(string(page[start:start+end]), "/"))
+		offset = start + end
+	}
+
+	return tags
+}
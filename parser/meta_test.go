@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractDescription(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{name: "description", html: `<head><meta charset="utf-8"><meta name="description" content="Making life  multiplanetary"></head>`, want: "Making life multiplanetary"},
+		{name: "attributes order and entities", html: `<META CONTENT='Falcon &amp; Dragon' NAME='Description' />`, want: "Falcon & Dragon"},
+		{name: "other meta tags", html: `<meta property="og:description" content="Open Graph"><meta name="keywords" content="rockets">`, want: ""},
+		{name: "no meta tags", html: `<p>name="description"</p>`, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ExtractDescription([]byte(test.html))
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{name: "canonical", html: `<link rel="stylesheet" href="/main.css"><link rel="canonical" href="https://www.spacex.com/vehicles/">`, want: "https://www.spacex.com/vehicles/"},
+		{name: "relative", html: `<LINK href='/launches?page=1&amp;sort=date' rel=canonical>`, want: "/launches?page=1&sort=date"},
+		{name: "no canonical", html: `<link rel="icon" href="/favicon.ico"><linkage rel="canonical" href="/wrong">`, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ExtractCanonical([]byte(test.html))
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindTags(t *testing.T) {
+	got := findTags([]byte(`<meta a="1"><metadata b="2"><META c="3"/><meta>`), "meta")
+	want := []string{` a="1"`, ` c="3"`, ``}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
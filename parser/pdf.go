@@ -0,0 +1,473 @@
+package parser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+var ErrNotPDF = errors.New("Document is not a PDF")
+
+// Names in dictionaries of streams which never contain text of the document: images, fonts,
+// cross-reference tables, XMP metadata and filters which can't be decoded
+var skippedPDFStreams = map[string]bool{
+	"Image":           true,
+	"FontFile":        true,
+	"FontFile2":       true,
+	"FontFile3":       true,
+	"Length1":         true,
+	"XRef":            true,
+	"Metadata":        true,
+	"ASCII85Decode":   true,
+	"ASCIIHexDecode":  true,
+	"LZWDecode":       true,
+	"RunLengthDecode": true,
+	"DCTDecode":       true,
+	"JPXDecode":       true,
+	"CCITTFaxDecode":  true,
+	"JBIG2Decode":     true,
+	"Crypt":           true,
+}
+
+// MaxDecodedSize is the maximum number of bytes decompressed from streams of a PDF document,
+// so small documents can't expand to exhaust memory
+var MaxDecodedSize int64 = 10 << 20
+
+// Kerning in thousandths of text space unit which is treated as a space between words
+const pdfWordSpacing = -200
+
+// ExtractPDF returns text shown by content streams of the document and title from its
+// information dictionary. Only uncompressed and FlateDecode streams are read. Strings are
+// decoded as Latin-1 or UTF-16 with BOM, so text of fonts with custom encodings is not extracted
+func ExtractPDF(body []byte) (Document, error) {
+	if !bytes.HasPrefix(body, []byte("%PDF-")) {
+		return Document{}, ErrNotPDF
+	}
+
+	var document Document
+	var text strings.Builder
+	streams := pdfStreams(body)
+	for _, stream := range streams {
+		text.WriteString(pdfContentText(stream))
+		text.WriteByte(' ')
+	}
+
+	// Information dictionary is either in the body or in one of the compressed object streams
+	for _, source := range append([][]byte{body}, streams...) {
+		if title := pdfTitle(source); title != "" {
+			document.Title = title
+			break
+		}
+	}
+	document.Text = strings.Join(strings.Fields(text.String()), " ")
+	return document, nil
+}
+
+// pdfStreams returns decoded data of the streams which may contain text. At most MaxDecodedSize
+// bytes are decompressed from all streams of the document
+func pdfStreams(body []byte) [][]byte {
+	var streams [][]byte
+	budget := MaxDecodedSize
+	// Position of the last "obj" before scanned, the body is scanned once
+	lastObj, scanned := -1, 0
+	for offset := 0; ; {
+		index := bytes.Index(body[offset:], []byte("stream"))
+		if index == -1 {
+			return streams
+		}
+		start := offset + index
+		offset = start + len("stream")
+
+		region := body[scanned:start]
+		scanned = start
+		dictionaryEnd := bytes.LastIndex(region, []byte(">>"))
+		dictionaryStart := lastObj
+		if obj := bytes.LastIndex(region, []byte("obj")); obj != -1 {
+			lastObj = start - len(region) + obj
+		}
+		if dictionaryEnd == -1 || len(bytes.TrimSpace(region[dictionaryEnd+2:])) > 0 {
+			continue
+		}
+		if obj := bytes.LastIndex(region[:dictionaryEnd], []byte("obj")); obj != -1 {
+			dictionaryStart = start - len(region) + obj
+		}
+		if dictionaryStart == -1 {
+			continue
+		}
+		dictionaryEnd += start - len(region)
+		names := pdfNames(body[dictionaryStart:dictionaryEnd])
+
+		dataStart := offset
+		if bytes.HasPrefix(body[dataStart:], []byte("\r\n")) {
+			dataStart += 2
+		} else if bytes.HasPrefix(body[dataStart:], []byte("\n")) {
+			dataStart++
+		}
+		dataEnd := bytes.Index(body[dataStart:], []byte("endstream"))
+		if dataEnd == -1 {
+			return streams
+		}
+		data := body[dataStart : dataStart+dataEnd]
+		offset = dataStart + dataEnd + len("endstream")
+
+		if skipPDFStream(names) {
+			continue
+		}
+		if names["FlateDecode"] {
+			if budget <= 0 {
+				continue
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// Streams are often truncated by a few bytes, everything decoded before the error is kept
+			data, _ = io.ReadAll(io.LimitReader(reader, budget))
+			budget -= int64(len(data))
+		}
+		streams = append(streams, data)
+	}
+}
+
+// pdfNames returns all names of the dictionary, both keys and values
+func pdfNames(dictionary []byte) map[string]bool {
+	names := make(map[string]bool)
+	lexer := pdfLexer{data: dictionary}
+	for token, ok := lexer.next(); ok; token, ok = lexer.next() {
+		if token.kind == pdfName {
+			names[token.value] = true
+		}
+	}
+	return names
+}
+
+func skipPDFStream(names map[string]bool) bool {
+	for name := range names {
+		if skippedPDFStreams[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfContentText returns strings shown by text operators of the content stream
+func pdfContentText(content []byte) string {
+	var text strings.Builder
+	lexer := pdfLexer{data: content}
+	var operands []pdfToken
+	var array []pdfToken
+	inArray := false
+
+	for {
+		token, ok := lexer.next()
+		if !ok {
+			break
+		}
+
+		switch token.kind {
+		case pdfArrayStart:
+			inArray, array = true, nil
+			continue
+		case pdfArrayEnd:
+			inArray = false
+			operands = append(operands, pdfToken{kind: pdfArrayEnd, array: array})
+			continue
+		case pdfOperator:
+		default:
+			if inArray {
+				array = append(array, token)
+			} else {
+				operands = append(operands, token)
+			}
+			continue
+		}
+
+		switch token.value {
+		case "Tj", "'", "\"":
+			if token.value != "Tj" {
+				text.WriteByte(' ')
+			}
+			if len(operands) > 0 && operands[len(operands)-1].kind == pdfString {
+				text.WriteString(decodePDFString(operands[len(operands)-1].value))
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				for _, element := range operands[len(operands)-1].array {
+					if element.kind == pdfString {
+						text.WriteString(decodePDFString(element.value))
+					} else if element.kind == pdfNumber && element.number < pdfWordSpacing {
+						text.WriteByte(' ')
+					}
+				}
+			}
+		case "Td", "TD", "T*", "Tm", "BT", "ET":
+			text.WriteByte(' ')
+		case "ID":
+			lexer.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+
+	return text.String()
+}
+
+// pdfTitle returns value of the "/Title" key
+func pdfTitle(source []byte) string {
+	for offset := 0; ; {
+		index := bytes.Index(source[offset:], []byte("/Title"))
+		if index == -1 {
+			return ""
+		}
+		offset += index + len("/Title")
+
+		lexer := pdfLexer{data: source[offset:]}
+		token, ok := lexer.next()
+		if ok && token.kind == pdfString {
+			if title := strings.Join(strings.Fields(decodePDFString(token.value)), " "); title != "" {
+				return title
+			}
+		}
+	}
+}
+
+// decodePDFString decodes UTF-16 strings with byte order mark and Latin-1 strings.
+// Control characters are dropped
+func decodePDFString(value string) string {
+	if strings.HasPrefix(value, "\xfe\xff") {
+		codes := make([]uint16, 0, len(value)/2)
+		for i := 2; i+1 < len(value); i += 2 {
+			codes = append(codes, uint16(value[i])<<8|uint16(value[i+1]))
+		}
+		return string(utf16.Decode(codes))
+	}
+
+	var decoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		switch {
+		case char == '\t' || char == '\n' || char == '\r':
+			decoded.WriteByte(' ')
+		case char < 0x20 || char == 0x7f:
+		default:
+			decoded.WriteRune(rune(char))
+		}
+	}
+	return decoded.String()
+}
+
+type pdfTokenKind int
+
+const (
+	pdfOperator pdfTokenKind = iota
+	pdfString
+	pdfNumber
+	pdfName
+	pdfArrayStart
+	pdfArrayEnd
+	pdfDictionary
+)
+
+type pdfToken struct {
+	kind   pdfTokenKind
+	value  string
+	number float64
+	array  []pdfToken
+}
+
+type pdfLexer struct {
+	data     []byte
+	position int
+}
+
+func isPDFDelimiter(char byte) bool {
+	return strings.IndexByte("()<>[]{}/%", char) != -1
+}
+
+func isPDFSpace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\r' || char == '\n' || char == '\f' || char == 0
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.position < len(l.data) {
+		char := l.data[l.position]
+		switch {
+		case isPDFSpace(char):
+			l.position++
+		case char == '%':
+			for l.position < len(l.data) && l.data[l.position] != '\n' && l.data[l.position] != '\r' {
+				l.position++
+			}
+		case char == '(':
+			return pdfToken{kind: pdfString, value: l.literalString()}, true
+		case char == '<':
+			if l.position+1 < len(l.data) && l.data[l.position+1] == '<' {
+				l.position += 2
+				return pdfToken{kind: pdfDictionary, value: "<<"}, true
+			}
+			return pdfToken{kind: pdfString, value: l.hexString()}, true
+		case char == '>':
+			l.position++
+			if l.position < len(l.data) && l.data[l.position] == '>' {
+				l.position++
+			}
+			return pdfToken{kind: pdfDictionary, value: ">>"}, true
+		case char == '[':
+			l.position++
+			return pdfToken{kind: pdfArrayStart}, true
+		case char == ']':
+			l.position++
+			return pdfToken{kind: pdfArrayEnd}, true
+		case char == '/':
+			l.position++
+			return pdfToken{kind: pdfName, value: l.regular()}, true
+		case char == '{' || char == '}' || char == ')':
+			l.position++
+		default:
+			value := l.regular()
+			if number, ok := parsePDFNumber(value); ok {
+				return pdfToken{kind: pdfNumber, value: value, number: number}, true
+			}
+			return pdfToken{kind: pdfOperator, value: value}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+func (l *pdfLexer) regular() string {
+	start := l.position
+	for l.position < len(l.data) && !isPDFSpace(l.data[l.position]) && !isPDFDelimiter(l.data[l.position]) {
+		l.position++
+	}
+	return string(l.data[start:l.position])
+}
+
+func parsePDFNumber(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	var number, fraction float64
+	sign, divider := 1.0, 0.0
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		switch {
+		case (char == '-' || char == '+') && i == 0:
+			if char == '-' {
+				sign = -1
+			}
+		case char == '.' && divider == 0:
+			divider = 1
+		case char >= '0' && char <= '9':
+			if divider == 0 {
+				number = number*10 + float64(char-'0')
+			} else {
+				divider *= 10
+				fraction += float64(char-'0') / divider
+			}
+		default:
+			return 0, false
+		}
+	}
+	return sign * (number + fraction), true
+}
+
+func (l *pdfLexer) literalString() string {
+	var value []byte
+	depth := 0
+	for l.position++; l.position < len(l.data); l.position++ {
+		char := l.data[l.position]
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				l.position++
+				return string(value)
+			}
+			depth--
+		case '\\':
+			l.position++
+			if l.position >= len(l.data) {
+				return string(value)
+			}
+			escaped := l.data[l.position]
+			switch escaped {
+			case 'n':
+				value = append(value, '\n')
+			case 'r':
+				value = append(value, '\r')
+			case 't':
+				value = append(value, '\t')
+			case 'b', 'f':
+			case '\r':
+				if l.position+1 < len(l.data) && l.data[l.position+1] == '\n' {
+					l.position++
+				}
+			case '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					code := 0
+					for digits := 0; digits < 3 && l.position < len(l.data) && l.data[l.position] >= '0' && l.data[l.position] <= '7'; digits++ {
+						code = code*8 + int(l.data[l.position]-'0')
+						l.position++
+					}
+					l.position--
+					value = append(value, byte(code))
+				} else {
+					value = append(value, escaped)
+				}
+			}
+			continue
+		}
+		value = append(value, char)
+	}
+	return string(value)
+}
+
+func (l *pdfLexer) hexString() string {
+	var value []byte
+	var digits []byte
+	for l.position++; l.position < len(l.data) && l.data[l.position] != '>'; l.position++ {
+		if digit, ok := hexDigit(l.data[l.position]); ok {
+			digits = append(digits, digit)
+		}
+	}
+	l.position++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, 0)
+	}
+	for i := 0; i < len(digits); i += 2 {
+		value = append(value, digits[i]<<4|digits[i+1])
+	}
+	return string(value)
+}
+
+func hexDigit(char byte) (byte, bool) {
+	switch {
+	case char >= '0' && char <= '9':
+		return char - '0', true
+	case char >= 'a' && char <= 'f':
+		return char - 'a' + 10, true
+	case char >= 'A' && char <= 'F':
+		return char - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// skipInlineImage moves the lexer after the data of inline image which ends with "EI"
+func (l *pdfLexer) skipInlineImage() {
+	for l.position < len(l.data) {
+		index := bytes.Index(l.data[l.position:], []byte("EI"))
+		if index == -1 {
+			l.position = len(l.data)
+			return
+		}
+		l.position += index + 2
+		if l.position >= 3 && isPDFSpace(l.data[l.position-3]) && (l.position == len(l.data) || isPDFSpace(l.data[l.position])) {
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a document with the streams given as dictionary and data pairs
+func buildPDF(info string, streams ...string) []byte {
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	if info != "" {
+		fmt.Fprintf(&pdf, "2 0 obj\n%s\nendobj\n", info)
+	}
+	for i := 0; i+1 < len(streams); i += 2 {
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nstream\r\n%s\nendstream\nendobj\n", i+3, streams[i], streams[i+1])
+	}
+	pdf.WriteString("trailer\n<< /Root 1 0 R /Info 2 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func deflate(data string) string {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte(data))
+	writer.Close()
+	return compressed.String()
+}
+
+func TestExtractPDF(t *testing.T) {
+	content := `BT /F1 12 Tf 72 712 Td (Falcon 9) Tj 0 -14 Td [(Star) 120 (ship) -300 (flight)] TJ
+	T* (Caf\351 \(test\) line\
+	two) ' ET`
+
+	tests := []struct {
+		name  string
+		pdf   []byte
+		title string
+		text  string
+	}{
+		{
+			name:  "uncompressed content",
+			pdf:   buildPDF("<< /Title (Launch \\(2023\\) Manifest) /Producer (Test) >>", "<< /Length 120 >>", content),
+			title: "Launch (2023) Manifest",
+			text:  "Falcon 9 Starship flight Café (test) line two",
+		},
+		{
+			name: "compressed content and skipped streams",
+			pdf: buildPDF("<< /Title <FEFF04200430043A0435044204300020> >>",
+				"<< /Length 10 /Filter /FlateDecode >>", deflate("BT (Compressed) Tj ET"),
+				"<< /Type /XObject /Subtype /Image /Width 1 >>", "BT (Image) Tj ET",
+				"<< /Filter [/DCTDecode] >>", "BT (JPEG) Tj ET",
+				"<< /Filter /FlateDecode >>", "broken data",
+			),
+			title: "Ракета",
+			text:  "Compressed",
+		},
+		{
+			name:  "title in object stream and inline image",
+			pdf:   buildPDF("", "<< /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode >>", deflate("2 0 << /Title (Packed) >>"), "<< >>", "BT (Before) Tj ET BI /W 1 /H 1 ID \x00EI(x)Tj\x01 EI BT (After) Tj ET"),
+			title: "Packed",
+			text:  "Before After",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExtractPDF(test.pdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != test.title || got.Text != test.text {
+				t.Errorf("got %q, %q, want %q, %q", got.Title, got.Text, test.title, test.text)
+			}
+		})
+	}
+
+	if _, err := ExtractPDF([]byte("<html></html>")); err != ErrNotPDF {
+		t.Errorf("got %v, want %v", err, ErrNotPDF)
+	}
+}
+
+func TestExtractByContentTypePDF(t *testing.T) {
+	got, err := Extract("application/pdf", buildPDF("<< /Title (Manifest) >>", "<< >>", "BT (Falcon) Tj ET"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Manifest" || got.Text != "Falcon" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestExtractPDFDecodedSizeLimit(t *testing.T) {
+	defer func(size int64) { MaxDecodedSize = size }(MaxDecodedSize)
+	MaxDecodedSize = 24
+
+	pdf := buildPDF("",
+		"<< /Filter /FlateDecode >>", deflate("BT (First) Tj ET "+strings.Repeat(" ", 1<<20)),
+		"<< /Filter /FlateDecode >>", deflate("BT (Second) Tj ET"),
+		"<< >>", "BT (Uncompressed) Tj ET",
+	)
+	got, err := ExtractPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "First Uncompressed"; got.Text != want {
+		t.Errorf("got %q, want %q", got.Text, want)
+	}
+}
+
+func BenchmarkExtractPDF(b *testing.B) {
+	var streams []string
+	for i := 0; i < 2000; i++ {
+		streams = append(streams, "<< /Length 20 >>", "BT (Falcon 9) Tj ET")
+	}
+	pdf := buildPDF("<< /Title (Manifest) >>", streams...)
+	for i := 0; i < b.N; i++ {
+		ExtractPDF(pdf)
+	}
+}
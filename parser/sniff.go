@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Lowercase letters which are the most frequent in Russian text
+const frequentCyrillic = "оеаинтсрвлкмдпу"
+
+// sniffCharset returns the charset of SniffedCharsets in which the start reads the most like text,
+// e.g. lowercase Cyrillic letters rather than accented Latin ones. DefaultCharset wins ties
+func sniffCharset(start []byte) string {
+	best, ok := charsetName(DefaultCharset)
+	if !ok {
+		best = "windows-1252"
+	}
+	// The prescanned start may cut a multibyte character, so it is scored up to the last ASCII byte
+	if len(start) >= charsetPrescanLength {
+		for end := len(start) - 1; end >= 0; end-- {
+			if start[end] < utf8.RuneSelf {
+				start = start[:end+1]
+				break
+			}
+		}
+	}
+
+	bestScore := charsetScore(best, start)
+	for _, label := range SniffedCharsets {
+		name, ok := charsetName(label)
+		if !ok {
+			continue
+		}
+		if score := charsetScore(name, start); score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best
+}
+
+// charsetScore returns how much the bytes decoded from the charset look like text. Letters of
+// scripts which are usually written apart from ASCII letters score when they aren't next to them.
+// Decoding with invalid sequences or control characters scores -1
+func charsetScore(charset string, start []byte) int {
+	charsetEncoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return -1
+	}
+	decoded, err := charsetEncoding.NewDecoder().Bytes(start)
+	if err != nil {
+		return -1
+	}
+
+	runes := []rune(string(decoded))
+	isASCIILetter := func(index int) bool {
+		return index >= 0 && index < len(runes) && runes[index] < utf8.RuneSelf && unicode.IsLetter(runes[index])
+	}
+	score := 0
+	for index, r := range runes {
+		if r < utf8.RuneSelf {
+			continue
+		}
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Co, r) {
+			return -1
+		}
+		nextToASCII := isASCIILetter(index-1) || isASCIILetter(index+1)
+
+		switch {
+		case r >= 0xFF61 && r <= 0xFF9F:
+			// Half-width katakana
+			score++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han):
+			score += 3
+		case r >= 'А' && r <= 'я' || r == 'ё' || r == 'Ё':
+			switch {
+			case nextToASCII:
+			case strings.ContainsRune(frequentCyrillic, r):
+				score += 3
+			case unicode.IsLower(r):
+				score += 2
+			default:
+				score++
+			}
+		case unicode.Is(unicode.Latin, r):
+			score++
+		}
+	}
+	return score
+}
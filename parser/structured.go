@@ -0,0 +1,296 @@
+package parser
+
+import (
+	"html"
+	"strings"
+)
+
+// StructuredData is machine-readable metadata of the page: schema.org items from JSON-LD and
+// microdata, OpenGraph and Twitter card properties
+type StructuredData struct {
+	// schema.org types of the items, e.g. "Article"
+	Types []string                 `json:"types,omitempty"`
+	Items []map[string]interface{} `json:"items,omitempty"`
+	// OpenGraph properties by their full name, e.g. "og:image" or "article:published_time"
+	OpenGraph map[string]string `json:"open_graph,omitempty"`
+	// Twitter card properties by their full name, e.g. "twitter:card"
+	TwitterCard map[string]string `json:"twitter_card,omitempty"`
+}
+
+// StructuredSummary is the part of structured data which is shown in search results
+type StructuredSummary struct {
+	Image       string `json:"image,omitempty"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	// Date as it is written in the data, e.g. "2023-03-01T10:00:00Z"
+	Published string `json:"published,omitempty"`
+}
+
+// Prefixes of OpenGraph properties, including properties of OpenGraph object types
+var openGraphPrefixes = []string{"og:", "article:", "product:", "book:", "profile:", "music:", "video:"}
+
+func (d StructuredData) IsEmpty() bool {
+	return len(d.Items) == 0 && len(d.OpenGraph) == 0 && len(d.TwitterCard) == 0
+}
+
+// addMeta adds <meta> of OpenGraph or Twitter card
+func (d *StructuredData) addMeta(attributes string) {
+	property := strings.ToLower(findAttribute(attributes, "property"))
+	if property == "" {
+		property = strings.ToLower(findAttribute(attributes, "name"))
+	}
+	content := normalizeSpace(strings.ReplaceAll(html.UnescapeString(findAttribute(attributes, "content")), "\x00", ""))
+	if property == "" || content == "" {
+		return
+	}
+
+	if strings.HasPrefix(property, "twitter:") {
+		if d.TwitterCard == nil {
+			d.TwitterCard = make(map[string]string)
+		}
+		if d.TwitterCard[property] == "" {
+			d.TwitterCard[property] = content
+		}
+		return
+	}
+	for _, prefix := range openGraphPrefixes {
+		if strings.HasPrefix(property, prefix) {
+			if d.OpenGraph == nil {
+				d.OpenGraph = make(map[string]string)
+			}
+			if d.OpenGraph[property] == "" {
+				d.OpenGraph[property] = content
+			}
+			return
+		}
+	}
+}
+
+// addItem adds schema.org item and its types, e.g. "Article" for "https://schema.org/Article"
+func (d *StructuredData) addItem(item map[string]interface{}) {
+	item = withoutNUL(item).(map[string]interface{})
+	d.Items = append(d.Items, item)
+	var types []string
+	switch itemType := item["@type"].(type) {
+	case string:
+		types = append(types, itemType)
+	case []interface{}:
+		for _, value := range itemType {
+			if value, ok := value.(string); ok {
+				types = append(types, value)
+			}
+		}
+	}
+
+	for _, itemType := range types {
+		itemType = itemType[strings.LastIndexAny(itemType, "/#:")+1:]
+		if itemType != "" && !containsString(d.Types, itemType) {
+			d.Types = append(d.Types, itemType)
+		}
+	}
+}
+
+// withoutNUL removes NUL characters from strings of the value, Postgres rejects them in jsonb
+func withoutNUL(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return strings.ReplaceAll(value, "\x00", "")
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			result[strings.ReplaceAll(key, "\x00", "")] = withoutNUL(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = withoutNUL(item)
+		}
+		return result
+	}
+	return value
+}
+
+// Summary returns image, description, author and date of the page. Values of schema.org items are
+// preferred to OpenGraph and Twitter card
+func (d StructuredData) Summary() StructuredSummary {
+	var summary StructuredSummary
+	for _, item := range d.Items {
+		if summary.Image == "" {
+			summary.Image = itemValue(item["image"], "url", "contentUrl")
+		}
+		if summary.Description == "" {
+			summary.Description = itemValue(item["description"])
+		}
+		if summary.Author == "" {
+			summary.Author = itemValue(item["author"], "name")
+		}
+		if summary.Published == "" {
+			summary.Published = itemValue(item["datePublished"])
+		}
+		if summary.Published == "" {
+			summary.Published = itemValue(item["startDate"])
+		}
+	}
+
+	firstOf := func(values ...string) string {
+		for _, value := range values {
+			if value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	summary.Image = firstOf(summary.Image, d.OpenGraph["og:image"], d.OpenGraph["og:image:url"], d.TwitterCard["twitter:image"])
+	summary.Description = firstOf(summary.Description, d.OpenGraph["og:description"], d.TwitterCard["twitter:description"])
+	summary.Author = firstOf(summary.Author, d.OpenGraph["article:author"], d.TwitterCard["twitter:creator"])
+	summary.Published = firstOf(summary.Published, d.OpenGraph["article:published_time"])
+	return summary
+}
+
+// itemValue returns the string value of item property. Value of nested item is taken from its
+// keys, the first value is used for multiple values
+func itemValue(value interface{}, keys ...string) string {
+	switch value := value.(type) {
+	case string:
+		return normalizeSpace(value)
+	case []interface{}:
+		for _, item := range value {
+			if found := itemValue(item, keys...); found != "" {
+				return found
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range keys {
+			if found := itemValue(value[key]); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Elements without closing tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// Element of microdata which is open. depth counts open elements with the same tag inside
+// it, so the element ends with its own closing tag
+type microdataElement struct {
+	tag   string
+	depth int
+	// itemprop of the element, empty for top-level items
+	property string
+	// Properties of item, nil for element of property with text value
+	item map[string]interface{}
+	text strings.Builder
+}
+
+// microdataParser collects items of microdata while HTML tags are read
+type microdataParser struct {
+	open  []*microdataElement
+	items []map[string]interface{}
+}
+
+func (p *microdataParser) openTag(name string, attributes string) {
+	for _, element := range p.open {
+		if element.tag == name {
+			element.depth++
+		}
+	}
+
+	property := findAttribute(attributes, "itemprop")
+	if hasAttribute(attributes, "itemscope") {
+		item := make(map[string]interface{})
+		if itemType := findAttribute(attributes, "itemtype"); itemType != "" {
+			item["@type"] = itemType[strings.LastIndexAny(itemType, "/#")+1:]
+		}
+		p.push(name, &microdataElement{tag: name, property: property, item: item})
+		return
+	}
+	if property == "" || len(p.open) == 0 {
+		return
+	}
+
+	for _, attribute := range []string{"content", "datetime", "href", "src"} {
+		if value := findAttribute(attributes, attribute); value != "" {
+			p.setProperty(property, normalizeSpace(html.UnescapeString(value)))
+			return
+		}
+	}
+	p.push(name, &microdataElement{tag: name, property: property})
+}
+
+// push opens the element. Void elements are closed at once
+func (p *microdataParser) push(name string, element *microdataElement) {
+	element.depth = 1
+	p.open = append(p.open, element)
+	if voidElements[name] {
+		p.closeTag(name)
+	}
+}
+
+func (p *microdataParser) closeTag(name string) {
+	for i := len(p.open) - 1; i >= 0; i-- {
+		element := p.open[i]
+		if element.tag != name {
+			continue
+		}
+		element.depth--
+		if element.depth > 0 {
+			continue
+		}
+
+		// Elements which weren't closed inside it are closed with it
+		p.open = p.open[:i]
+		switch {
+		case element.item == nil:
+			p.setProperty(element.property, normalizeSpace(html.UnescapeString(element.text.String())))
+		case element.property != "" && len(p.open) > 0:
+			p.setProperty(element.property, element.item)
+		default:
+			p.items = append(p.items, element.item)
+		}
+	}
+}
+
+func (p *microdataParser) write(char byte) {
+	for _, element := range p.open {
+		if element.item == nil {
+			element.text.WriteByte(char)
+		}
+	}
+}
+
+// setProperty sets the property of the innermost item, repeated properties have list of values
+func (p *microdataParser) setProperty(property string, value interface{}) {
+	var item map[string]interface{}
+	for i := len(p.open) - 1; i >= 0 && item == nil; i-- {
+		item = p.open[i].item
+	}
+	if item == nil || value == "" {
+		return
+	}
+
+	for _, name := range strings.Fields(property) {
+		switch existing := item[name].(type) {
+		case nil:
+			item[name] = value
+		case []interface{}:
+			item[name] = append(existing, value)
+		default:
+			item[name] = []interface{}{existing, value}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+const articlePage = `<html><head>
+	<meta property="og:title" content="Starship flight test">
+	<meta property="og:image" content="https://www.spacex.com/og.jpg">
+	<meta property="article:published_time" content="2023-04-20">
+	<meta name="twitter:card" content="summary_large_image">
+	<meta name="twitter:creator" content="@SpaceX">
+	<meta name="description" content="Not structured">
+</head><body>
+	<article itemscope itemtype="https://schema.org/Article">
+		<h1 itemprop="headline">Starship <b>flight</b> test</h1>
+		<div itemprop="author" itemscope itemtype="https://schema.org/Person">
+			<span itemprop="name">Elon &amp; team</span>
+		</div>
+		<time itemprop="datePublished" datetime="2023-04-20T13:33:00Z">April 20</time>
+		<img itemprop="image" src="/starship.jpg">
+		<div><div itemprop="articleBody">Liftoff</div></div>
+		<span itemprop="keywords">rocket</span><span itemprop="keywords">test</span>
+	</article>
+	<div itemscope itemtype="https://schema.org/Event"><span itemprop="name">Launch</span><meta itemprop="startDate" content="2023-05-01"></div>
+</body></html>`
+
+func TestExtractStructuredData(t *testing.T) {
+	want := StructuredData{
+		Types: []string{"Article", "Event"},
+		Items: []map[string]interface{}{
+			{
+				"@type":         "Article",
+				"headline":      "Starship flight test",
+				"author":        map[string]interface{}{"@type": "Person", "name": "Elon & team"},
+				"datePublished": "2023-04-20T13:33:00Z",
+				"image":         "/starship.jpg",
+				"articleBody":   "Liftoff",
+				"keywords":      []interface{}{"rocket", "test"},
+			},
+			{"@type": "Event", "name": "Launch", "startDate": "2023-05-01"},
+		},
+		OpenGraph: map[string]string{
+			"og:title":               "Starship flight test",
+			"og:image":               "https://www.spacex.com/og.jpg",
+			"article:published_time": "2023-04-20",
+		},
+		TwitterCard: map[string]string{
+			"twitter:card":    "summary_large_image",
+			"twitter:creator": "@SpaceX",
+		},
+	}
+
+	got, err := ExtractHTML([]byte(articlePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.StructuredData, want) {
+		t.Errorf("got %+v\nwant %+v", got.StructuredData, want)
+	}
+}
+
+func TestStructuredDataSummary(t *testing.T) {
+	tests := []struct {
+		name string
+		data StructuredData
+		want StructuredSummary
+	}{
+		{
+			name: "items are preferred",
+			data: StructuredData{
+				Items: []map[string]interface{}{
+					{"@type": "Organization", "name": "SpaceX"},
+					{
+						"@type":         "NewsArticle",
+						"image":         []interface{}{map[string]interface{}{"url": "https://www.spacex.com/1.jpg"}, "https://www.spacex.com/2.jpg"},
+						"author":        []interface{}{map[string]interface{}{"name": "SpaceX"}},
+						"datePublished": "2023-04-20",
+						"description":   "Flight test",
+					},
+				},
+				OpenGraph: map[string]string{"og:image": "https://www.spacex.com/og.jpg", "og:description": "Open graph"},
+			},
+			want: StructuredSummary{Image: "https://www.spacex.com/1.jpg", Description: "Flight test", Author: "SpaceX", Published: "2023-04-20"},
+		},
+		{
+			name: "open graph and twitter card",
+			data: StructuredData{
+				OpenGraph:   map[string]string{"og:image": "https://www.spacex.com/og.jpg", "article:published_time": "2023-04-20"},
+				TwitterCard: map[string]string{"twitter:description": "Flight test", "twitter:creator": "@SpaceX"},
+			},
+			want: StructuredSummary{Image: "https://www.spacex.com/og.jpg", Description: "Flight test", Author: "@SpaceX", Published: "2023-04-20"},
+		},
+		{
+			name: "date of event",
+			data: StructuredData{Items: []map[string]interface{}{{"@type": "Event", "startDate": "2023-05-01"}}},
+			want: StructuredSummary{Published: "2023-05-01"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.data.Summary(); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStructuredDataTypes(t *testing.T) {
+	var data StructuredData
+	data.addItem(map[string]interface{}{"@type": "https://schema.org/Product"})
+	data.addItem(map[string]interface{}{"@type": []interface{}{"Product", "schema:Offer"}})
+	data.addItem(map[string]interface{}{"name": "Without type"})
+
+	if want := []string{"Product", "Offer"}; !reflect.DeepEqual(data.Types, want) {
+		t.Errorf("got %v, want %v", data.Types, want)
+	}
+}
+
+func TestStructuredDataWithoutNUL(t *testing.T) {
+	page := "<meta property=\"og:title\" content=\"Star\x00ship\">" +
+		`<script type="application/ld+json">{"@type": "Article", "headline": "Star\u0000ship", "keywords": ["a\u0000"], "x\u0000": 1}</script>`
+
+	got, err := ExtractHTML([]byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := StructuredData{
+		Types:     []string{"Article"},
+		Items:     []map[string]interface{}{{"@type": "Article", "headline": "Starship", "keywords": []interface{}{"a"}, "x": float64(1)}},
+		OpenGraph: map[string]string{"og:title": "Starship"},
+	}
+	if !reflect.DeepEqual(got.StructuredData, want) {
+		t.Errorf("got %+v\nwant %+v", got.StructuredData, want)
+	}
+}
+
+func TestHasAttribute(t *testing.T) {
+	tests := map[string]bool{
+		` itemscope itemtype="https://schema.org/Article"`: true,
+		` class="a" itemscope`:                             true,
+		` itemscope="itemscope"`:                           true,
+		` data-itemscope itemprop="name"`:                  false,
+		` itemscopes`:                                      false,
+	}
+
+	for attributes, want := range tests {
+		if got := hasAttribute(attributes, "itemscope"); got != want {
+			t.Errorf("%q: got %v, want %v", attributes, got, want)
+		}
+	}
+}
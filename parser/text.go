@@ -0,0 +1,12 @@
+package parser
+
+// ExtractText returns visible text of the page without tags, comments, scripts and styles
+func ExtractText(page []byte) string {
+	return extractPage(page).Text
+}
+
+// extractPage returns document of the whole page, reading from memory never fails
+func extractPage(page []byte) Document {
+	document, _ := ExtractHTML(page)
+	return document
+}
@@ -0,0 +1,35 @@
+package parser
+
+import "testing"
+
+func TestExtractText(t *testing.T) {
+	t.Run("extract text from tags", func(t *testing.T) {
+		html := []byte(`<html><head><title>SpaceX</title></head><body><h1>Falcon  9</h1>
+		<p class="intro">Reusable <b>rocket</b></p></body></html>`)
+		got := ExtractText(html)
+		want := "SpaceX Falcon 9 Reusable rocket"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("skip scripts, styles and comments", func(t *testing.T) {
+		html := []byte(`<html><head><style>h1 { color: red; }</style>
+		<SCRIPT type="text/javascript">var launch = "<b>starlink</b>";</SCRIPT></head>
+		<body><!-- <p>hidden</p> --><p>Dragon</p><scripts>visible</scripts></body></html>`)
+		got := ExtractText(html)
+		want := "Dragon visible"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("decode entities", func(t *testing.T) {
+		html := []byte(`<p>Research &amp; Development&nbsp;&#8212; R&amp;D</p>`)
+		got := ExtractText(html)
+		want := "Research & Development — R&D"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
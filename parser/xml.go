@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// ExtractXML returns character data of all elements. The first "title" element is used as the title
+func ExtractXML(body []byte) (Document, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	// Documents are expected to be decoded to UTF-8 before extraction
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var document Document
+	var text, title strings.Builder
+	inTitle, titleFound := false, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if text.Len() == 0 {
+				return document, err
+			}
+			break
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local == "title" && !titleFound {
+				inTitle = true
+			}
+		case xml.EndElement:
+			if inTitle && token.Name.Local == "title" {
+				inTitle, titleFound = false, true
+			}
+			text.WriteByte(' ')
+		case xml.CharData:
+			text.Write(token)
+			if inTitle {
+				title.Write(token)
+			}
+		}
+	}
+
+	document.Title = strings.Join(strings.Fields(title.String()), " ")
+	document.Text = strings.Join(strings.Fields(text.String()), " ")
+	return document, nil
+}
@@ -0,0 +1,46 @@
+package parser
+
+import "testing"
+
+func TestExtractXML(t *testing.T) {
+	tests := []struct {
+		name  string
+		xml   string
+		title string
+		text  string
+	}{
+		{
+			name:  "atom feed",
+			xml:   `<?xml version="1.0" encoding="utf-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>SpaceX &amp; NASA</title><entry><title>Crew-7</title><summary><![CDATA[Docked to <b>ISS</b>]]></summary></entry></feed>`,
+			title: "SpaceX & NASA",
+			text:  "SpaceX & NASA Crew-7 Docked to <b>ISS</b>",
+		},
+		{
+			name: "declared charset and no title",
+			xml:  `<?xml version="1.0" encoding="windows-1251"?><launches><launch date="2023-08-26">Crew-7</launch><launch>Starlink</launch></launches>`,
+			text: "Crew-7 Starlink",
+		},
+		{
+			name:  "unclosed elements",
+			xml:   `<page><title>Draft</title><p>Unclosed paragraph`,
+			title: "Draft",
+			text:  "Draft Unclosed paragraph",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExtractXML([]byte(test.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != test.title || got.Text != test.text {
+				t.Errorf("got %q, %q, want %q, %q", got.Title, got.Text, test.title, test.text)
+			}
+		})
+	}
+
+	if _, err := ExtractXML([]byte(`<`)); err == nil {
+		t.Error("expected error for invalid document")
+	}
+}
@@ -0,0 +1,66 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/Moranilt/search-engine/analyzer"
+)
+
+// Analyze normalizes values of content and title terms with the analyzer, so they can be
+// compared with analyzed tokens of pages. Terms without any tokens are removed; nil is returned
+// if nothing is left to find.
+func Analyze(node Node, a analyzer.Analyzer) Node {
+	switch n := node.(type) {
+	case Term:
+		if n.Field != "" && n.Field != FieldTitle {
+			return n
+		}
+		tokens := a.Tokenize(n.Value)
+		if len(tokens) == 0 {
+			return nil
+		}
+		n.Value = strings.Join(tokens, " ")
+		return n
+	case And:
+		nodes := analyzeNodes(n.Nodes, a)
+		switch len(nodes) {
+		case 0:
+			return nil
+		case 1:
+			return nodes[0]
+		}
+		return And{Nodes: nodes}
+	case Or:
+		nodes := analyzeNodes(n.Nodes, a)
+		switch len(nodes) {
+		case 0:
+			return nil
+		case 1:
+			return nodes[0]
+		}
+		return Or{Nodes: nodes}
+	case Not:
+		child := Analyze(n.Node, a)
+		if child == nil {
+			return nil
+		}
+		return Not{Node: child}
+	}
+	return node
+}
+
+func analyzeNodes(nodes []Node, a analyzer.Analyzer) []Node {
+	var result []Node
+	for _, node := range nodes {
+		if analyzed := Analyze(node, a); analyzed != nil {
+			result = append(result, analyzed)
+		}
+	}
+	return result
+}
+
+// ContainsTerm reports whether tokens of a page analyzed with pageAnalyzer contain the term
+// value. The value is stemmed and cleared of stop words with the same analyzer.
+func ContainsTerm(tokens []string, value string, pageAnalyzer analyzer.Analyzer) bool {
+	return analyzer.Contains(tokens, pageAnalyzer.AnalyzeTokens(strings.Fields(value)))
+}
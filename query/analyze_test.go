@@ -0,0 +1,53 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Moranilt/search-engine/analyzer"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Node
+	}{
+		{
+			name:  "normalizes content and title terms",
+			query: `"Launch  WINDOW" title:Falcon-9 site:WWW.SpaceX.com path:/Vehicles`,
+			want: And{Nodes: []Node{
+				Term{Value: "launch window", Phrase: true},
+				Term{Field: FieldTitle, Value: "falcon 9"},
+				Term{Field: FieldSite, Value: "WWW.SpaceX.com"},
+				Term{Field: FieldPath, Value: "/Vehicles"},
+			}},
+		},
+		{
+			name:  "removes terms without tokens",
+			query: "falcon -!!! (* OR Dragon)",
+			want: And{Nodes: []Node{
+				Term{Value: "falcon"},
+				Term{Value: "dragon"},
+			}},
+		},
+		{
+			name:  "nothing to find",
+			query: "-- ...",
+			want:  nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := Parse(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Analyze(node, analyzer.New())
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package query
+
+import (
+	"strings"
+)
+
+// mapTerms returns copy of the query with every term replaced by the result of replace
+func mapTerms(node Node, replace func(term Term) Node) Node {
+	switch n := node.(type) {
+	case Term:
+		return replace(n)
+	case And:
+		nodes := make([]Node, len(n.Nodes))
+		for i, child := range n.Nodes {
+			nodes[i] = mapTerms(child, replace)
+		}
+		return And{Nodes: nodes}
+	case Or:
+		nodes := make([]Node, len(n.Nodes))
+		for i, child := range n.Nodes {
+			nodes[i] = mapTerms(child, replace)
+		}
+		return Or{Nodes: nodes}
+	case Not:
+		return Not{Node: mapTerms(n.Node, replace)}
+	}
+	return node
+}
+
+func correctTerm(term Term, correct func(word string) string) Term {
+	if term.Field != "" && term.Field != FieldTitle {
+		return term
+	}
+	words := strings.Fields(term.Value)
+	for i, word := range words {
+		words[i] = correct(word)
+	}
+	term.Value = strings.Join(words, " ")
+	return term
+}
+
+// Correct returns the query with every word of content and title terms replaced by correct(word)
+func Correct(node Node, correct func(word string) string) Node {
+	return mapTerms(node, func(term Term) Node {
+		return correctTerm(term, correct)
+	})
+}
+
+// Fuzzy returns the query where every term with corrected words matches either
+// the original or the corrected value, e.g. "falcn" becomes "(falcn OR falcon)"
+func Fuzzy(node Node, correct func(word string) string) Node {
+	return mapTerms(node, func(term Term) Node {
+		corrected := correctTerm(term, correct)
+		if corrected == term {
+			return term
+		}
+		return Or{Nodes: []Node{term, corrected}}
+	})
+}
+
+// String formats the query back to the search syntax
+func String(node Node) string {
+	switch n := node.(type) {
+	case Term:
+		value := n.Value
+		if n.Phrase {
+			value = `"` + value + `"`
+		}
+		if n.Field != "" {
+			return n.Field + ":" + value
+		}
+		return value
+	case And:
+		parts := make([]string, len(n.Nodes))
+		for i, child := range n.Nodes {
+			parts[i] = String(child)
+			if _, isOr := child.(Or); isOr {
+				parts[i] = "(" + parts[i] + ")"
+			}
+		}
+		return strings.Join(parts, " ")
+	case Or:
+		parts := make([]string, len(n.Nodes))
+		for i, child := range n.Nodes {
+			parts[i] = String(child)
+		}
+		return strings.Join(parts, " OR ")
+	case Not:
+		switch n.Node.(type) {
+		case And, Or:
+			return "-(" + String(n.Node) + ")"
+		}
+		return "-" + String(n.Node)
+	}
+	return ""
+}
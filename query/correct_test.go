@@ -0,0 +1,65 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+var corrections = map[string]string{"falcn": "falcon", "lanch": "launch", "strlink": "starlink"}
+
+func correctWord(word string) string {
+	if corrected, ok := corrections[word]; ok {
+		return corrected
+	}
+	return word
+}
+
+func TestCorrect(t *testing.T) {
+	tests := map[string]string{
+		"falcn heavy":                        "falcon heavy",
+		`"next lanch" -strlink`:              `"next launch" -starlink`,
+		"title:falcn site:falcn.com":         "title:falcon site:falcn.com",
+		"(falcn OR dragon) -(lanch strlink)": "(falcon OR dragon) -(launch starlink)",
+		"dragon":                             "dragon",
+	}
+
+	for text, want := range tests {
+		t.Run(text, func(t *testing.T) {
+			node, err := Parse(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := String(Correct(node, correctWord)); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	node, err := Parse("falcn heavy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Fuzzy(node, correctWord)
+	want := And{Nodes: []Node{
+		Or{Nodes: []Node{Term{Value: "falcn"}, Term{Value: "falcon"}}},
+		Term{Value: "heavy"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestString(t *testing.T) {
+	text := `"launch window" (falcon OR title:dragon) -starlink -(path:/careers OR inurl:jobs)`
+
+	node, err := Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := String(node); got != text {
+		t.Errorf("got %q, want %q", got, text)
+	}
+}
@@ -0,0 +1,130 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/Moranilt/search-engine/analyzer"
+)
+
+const (
+	FieldTitle  = "title"
+	FieldSite   = "site"
+	FieldPath   = "path"
+	FieldURL    = "inurl"
+	FieldSchema = "schema"
+)
+
+var fields = map[string]bool{
+	FieldTitle:  true,
+	FieldSite:   true,
+	FieldPath:   true,
+	FieldURL:    true,
+	FieldSchema: true,
+}
+
+// Page holds indexed fields of an endpoint which can be targeted by field operators
+type Page struct {
+	// Host name without scheme, e.g. "www.spacex.com"
+	Host  string
+	Path  string
+	Title string
+	// Title analyzed with Analyzer in the language of the page
+	TitleTokens []string
+	// Analyzed texts of links from other pages to this one
+	AnchorTokens [][]string
+	Analyzer     analyzer.Analyzer
+	// Detected language code and media type of the page, e.g. "en" and "text/html"
+	Language    string
+	ContentType string
+	// schema.org types of structured data of the page, e.g. "Article"
+	SchemaTypes []string
+}
+
+func (p Page) URL() string {
+	return p.Host + p.Path
+}
+
+// AnchorsContain reports whether text of any link to the page contains the term value
+func (p Page) AnchorsContain(value string) bool {
+	if len(p.AnchorTokens) == 0 {
+		return false
+	}
+
+	phrase := p.Analyzer.AnalyzeTokens(strings.Fields(value))
+	for _, tokens := range p.AnchorTokens {
+		if analyzer.Contains(tokens, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchField reports whether the page matches a term with field operator.
+//
+//	title:falcon       - title contains "falcon" token
+//	site:spacex.com    - page belongs to spacex.com or any of its subdomains
+//	path:/vehicles/*   - path matches the pattern, "*" matches any sequence of characters.
+//	                     Pattern without "*" matches the path and everything below it
+//	inurl:launch       - URL of the page contains "launch"
+//	schema:Article     - structured data of the page has schema.org type "Article"
+func (t Term) MatchField(page Page) bool {
+	switch t.Field {
+	case FieldTitle:
+		return ContainsTerm(page.TitleTokens, t.Value, page.Analyzer)
+	case FieldSite:
+		return MatchSite(page.Host, t.Value)
+	case FieldPath:
+		return matchPath(page.Path, t.Value)
+	case FieldURL:
+		return strings.Contains(strings.ToLower(page.URL()), strings.ToLower(t.Value))
+	case FieldSchema:
+		for _, schemaType := range page.SchemaTypes {
+			if strings.EqualFold(schemaType, t.Value) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// MatchSite reports whether host is the site or one of its subdomains
+func MatchSite(host string, site string) bool {
+	host = strings.ToLower(host)
+	site = strings.ToLower(strings.TrimSuffix(site, "/"))
+	return host == site || strings.HasSuffix(host, "."+site)
+}
+
+func matchPath(path string, pattern string) bool {
+	if !strings.Contains(pattern, "*") {
+		return path == pattern || strings.HasPrefix(path, strings.TrimSuffix(pattern, "/")+"/")
+	}
+
+	chunks := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, chunks[0]) {
+		return false
+	}
+	path = path[len(chunks[0]):]
+
+	last := len(chunks) - 1
+	for _, chunk := range chunks[1:last] {
+		index := strings.Index(path, chunk)
+		if index == -1 {
+			return false
+		}
+		path = path[index+len(chunk):]
+	}
+
+	return strings.HasSuffix(path, chunks[last])
+}
+
+// Sites resolves query for a host using only "site:" operators. NotMatched means that
+// no page of the host can match the query.
+func Sites(node Node, host string) Match {
+	return node.Resolve(func(term Term) Match {
+		if term.Field == FieldSite {
+			return matchOf(MatchSite(host, term.Value))
+		}
+		return Unknown
+	})
+}
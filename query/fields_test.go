@@ -0,0 +1,90 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/Moranilt/search-engine/analyzer"
+)
+
+func TestMatchField(t *testing.T) {
+	page := Page{
+		Host:        "www.spacex.com",
+		Path:        "/vehicles/falcon-heavy",
+		Title:       "SpaceX - Falcon Heavy",
+		TitleTokens: []string{"spacex", "falcon", "heavi"},
+		Analyzer:    analyzer.New().WithLanguage("en"),
+		SchemaTypes: []string{"Product", "Offer"},
+	}
+
+	tests := []struct {
+		term Term
+		want bool
+	}{
+		{term: Term{Field: FieldTitle, Value: "falcon heavy"}, want: true},
+		{term: Term{Field: FieldTitle, Value: "falcon"}, want: true},
+		{term: Term{Field: FieldTitle, Value: "heavy falcon"}, want: false},
+		{term: Term{Field: FieldTitle, Value: "Dragon"}, want: false},
+		{term: Term{Field: FieldSite, Value: "www.spacex.com"}, want: true},
+		{term: Term{Field: FieldSite, Value: "SpaceX.com"}, want: true},
+		{term: Term{Field: FieldSite, Value: "x.com"}, want: false},
+		{term: Term{Field: FieldPath, Value: "/vehicles/*"}, want: true},
+		{term: Term{Field: FieldPath, Value: "/vehicles"}, want: true},
+		{term: Term{Field: FieldPath, Value: "/vehicle"}, want: false},
+		{term: Term{Field: FieldPath, Value: "/*/falcon-*"}, want: true},
+		{term: Term{Field: FieldPath, Value: "*/dragon"}, want: false},
+		{term: Term{Field: FieldURL, Value: "spacex.com/vehicles"}, want: true},
+		{term: Term{Field: FieldURL, Value: "launch"}, want: false},
+		{term: Term{Field: FieldSchema, Value: "product"}, want: true},
+		{term: Term{Field: FieldSchema, Value: "Article"}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.term.Field+":"+test.term.Value, func(t *testing.T) {
+			if got := test.term.MatchField(page); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAnchorsContain(t *testing.T) {
+	page := Page{
+		AnchorTokens: [][]string{{"reusabl", "rocket"}, {"heavi", "lift"}},
+		Analyzer:     analyzer.New().WithLanguage("en"),
+	}
+
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "rockets", want: true},
+		{value: "reusable rockets", want: true},
+		{value: "heavy lift", want: true},
+		{value: "rocket heavy", want: false},
+		{value: "dragon", want: false},
+	}
+
+	for _, test := range tests {
+		if got := page.AnchorsContain(test.value); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.value, got, test.want)
+		}
+	}
+
+	if (Page{Analyzer: page.Analyzer}).AnchorsContain("rockets") {
+		t.Error("page without links must not contain anything")
+	}
+}
+
+func TestSites(t *testing.T) {
+	node, err := Parse("falcon site:spacex.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Sites(node, "www.nasa.gov"); got != NotMatched {
+		t.Errorf("got %v, want %v", got, NotMatched)
+	}
+	if got := Sites(node, "www.spacex.com"); got != Unknown {
+		t.Errorf("got %v, want %v", got, Unknown)
+	}
+}
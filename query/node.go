@@ -0,0 +1,154 @@
+package query
+
+// Match is a result of resolving a query when some of the terms are not known yet
+type Match int
+
+const (
+	Unknown Match = iota
+	Matched
+	NotMatched
+)
+
+func matchOf(matches bool) Match {
+	if matches {
+		return Matched
+	}
+	return NotMatched
+}
+
+// Node is a part of parsed search query
+type Node interface {
+	// Eval reports whether the node matches a document. matches is called for every term
+	// and reports whether the document has it.
+	Eval(matches func(term Term) bool) bool
+	// Resolve is like Eval but terms may be Unknown. The result is Unknown only if it depends
+	// on unknown terms.
+	Resolve(resolve func(term Term) Match) Match
+}
+
+// Term is a single word or an "exact phrase" from the query. Field is set for
+// terms scoped with an operator like "title:falcon".
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool
+}
+
+type And struct {
+	Nodes []Node
+}
+
+type Or struct {
+	Nodes []Node
+}
+
+type Not struct {
+	Node Node
+}
+
+func (t Term) Eval(matches func(term Term) bool) bool {
+	return matches(t)
+}
+
+func (t Term) Resolve(resolve func(term Term) Match) Match {
+	return resolve(t)
+}
+
+func (a And) Eval(matches func(term Term) bool) bool {
+	for _, node := range a.Nodes {
+		if !node.Eval(matches) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a And) Resolve(resolve func(term Term) Match) Match {
+	result := Matched
+	for _, node := range a.Nodes {
+		switch node.Resolve(resolve) {
+		case NotMatched:
+			return NotMatched
+		case Unknown:
+			result = Unknown
+		}
+	}
+	return result
+}
+
+func (o Or) Eval(matches func(term Term) bool) bool {
+	for _, node := range o.Nodes {
+		if node.Eval(matches) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Or) Resolve(resolve func(term Term) Match) Match {
+	result := NotMatched
+	for _, node := range o.Nodes {
+		switch node.Resolve(resolve) {
+		case Matched:
+			return Matched
+		case Unknown:
+			result = Unknown
+		}
+	}
+	return result
+}
+
+func (n Not) Eval(matches func(term Term) bool) bool {
+	return !n.Node.Eval(matches)
+}
+
+func (n Not) Resolve(resolve func(term Term) Match) Match {
+	switch n.Node.Resolve(resolve) {
+	case Matched:
+		return NotMatched
+	case NotMatched:
+		return Matched
+	}
+	return Unknown
+}
+
+// Terms returns unique values of all terms matched against page content
+// (without field operator) in the order they appear in the query
+func Terms(node Node) []string {
+	return collectTerms(node, false)
+}
+
+// PositiveTerms is like Terms but skips terms excluded with "-", so it returns
+// the terms which can be found in matched pages
+func PositiveTerms(node Node) []string {
+	return collectTerms(node, true)
+}
+
+func collectTerms(node Node, skipNegated bool) []string {
+	var terms []string
+	unique := make(map[string]bool)
+
+	var walk func(node Node, negated bool)
+	walk = func(node Node, negated bool) {
+		switch n := node.(type) {
+		case Term:
+			if n.Field == "" && !unique[n.Value] && !(skipNegated && negated) {
+				unique[n.Value] = true
+				terms = append(terms, n.Value)
+			}
+		case And:
+			for _, child := range n.Nodes {
+				walk(child, negated)
+			}
+		case Or:
+			for _, child := range n.Nodes {
+				walk(child, negated)
+			}
+		case Not:
+			walk(n.Node, !negated)
+		}
+	}
+	walk(node, false)
+
+	return terms
+}
@@ -0,0 +1,95 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	page := "Falcon 9 is a reusable rocket. The next launch window opens on Monday."
+	contains := func(term Term) bool {
+		return strings.Contains(page, term.Value)
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "Falcon rocket", want: true},
+		{query: "Falcon Starship", want: false},
+		{query: "Starship OR Falcon", want: true},
+		{query: `"launch window" -Starlink`, want: true},
+		{query: `"window launch"`, want: false},
+		{query: "Falcon -(rocket OR Starlink)", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			node, err := Parse(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := node.Eval(contains); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	known := map[string]Match{"falcon": Matched, "starlink": NotMatched}
+	resolve := func(term Term) Match {
+		return known[term.Value]
+	}
+
+	tests := []struct {
+		query string
+		want  Match
+	}{
+		{query: "falcon -starlink", want: Matched},
+		{query: "falcon dragon", want: Unknown},
+		{query: "starlink dragon", want: NotMatched},
+		{query: "falcon OR dragon", want: Matched},
+		{query: "starlink OR dragon", want: Unknown},
+		{query: "-(falcon OR dragon)", want: NotMatched},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			node, err := Parse(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := node.Resolve(resolve); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTerms(t *testing.T) {
+	node, err := Parse(`(falcon OR "launch window") -starlink falcon title:dragon`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Terms(node)
+	want := []string{"falcon", "launch window", "starlink"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPositiveTerms(t *testing.T) {
+	node, err := Parse(`(falcon OR "launch window") -starlink -(dragon -crew) title:heavy`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := PositiveTerms(node)
+	want := []string{"falcon", "launch window", "crew"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
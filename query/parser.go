@@ -0,0 +1,227 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrEmptyQuery            = errors.New("Nothing to find")
+	ErrUnterminatedPhrase    = errors.New("Query has unterminated quoted phrase")
+	ErrUnbalancedParenthesis = errors.New("Query has unbalanced parenthesis")
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenOr
+	tokenAnd
+	tokenMinus
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind  tokenKind
+	field string
+	value string
+}
+
+func readPhrase(runes []rune, start int) (string, int, error) {
+	end := start + 1
+	for end < len(runes) && runes[end] != '"' {
+		end++
+	}
+	if end == len(runes) {
+		return "", end, ErrUnterminatedPhrase
+	}
+	return strings.Join(strings.Fields(string(runes[start+1:end])), " "), end, nil
+}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case unicode.IsSpace(char):
+		case char == '(':
+			tokens = append(tokens, token{kind: tokenOpen})
+		case char == ')':
+			tokens = append(tokens, token{kind: tokenClose})
+		case char == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, token{kind: tokenMinus})
+		case char == '"':
+			phrase, end, err := readPhrase(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			if phrase != "" {
+				tokens = append(tokens, token{kind: tokenPhrase, value: phrase})
+			}
+			i = end
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			field, value, scoped := strings.Cut(word, ":")
+			switch {
+			case word == "OR" || word == "|":
+				tokens = append(tokens, token{kind: tokenOr})
+			case word == "AND":
+				tokens = append(tokens, token{kind: tokenAnd})
+			case scoped && fields[field] && value == "" && end < len(runes) && runes[end] == '"':
+				phrase, phraseEnd, err := readPhrase(runes, end)
+				if err != nil {
+					return nil, err
+				}
+				if phrase != "" {
+					tokens = append(tokens, token{kind: tokenPhrase, field: field, value: phrase})
+				}
+				end = phraseEnd + 1
+			case scoped && fields[field] && value != "":
+				tokens = append(tokens, token{kind: tokenWord, field: field, value: value})
+			default:
+				tokens = append(tokens, token{kind: tokenWord, value: word})
+			}
+			i = end - 1
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens   []token
+	position int
+}
+
+// Parse builds a query tree from text. Terms separated by spaces are joined with implicit AND,
+// "OR" joins alternatives, "-" excludes the following term, quotes keep an exact phrase
+// and parentheses group terms. Terms prefixed with "title:", "site:", "path:" or "inurl:"
+// are matched against the corresponding field of the page instead of its content.
+func Parse(text string) (Node, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.position < len(p.tokens) {
+		return nil, ErrUnbalancedParenthesis
+	}
+	if node == nil {
+		return nil, ErrEmptyQuery
+	}
+
+	return node, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position], true
+	}
+	return token{}, false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	var nodes []Node
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+
+		next, ok := p.peek()
+		if !ok || next.kind != tokenOr {
+			break
+		}
+		p.position++
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		next, ok := p.peek()
+		if !ok || next.kind == tokenOr || next.kind == tokenClose {
+			break
+		}
+		if next.kind == tokenAnd {
+			p.position++
+			continue
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	current := p.tokens[p.position]
+	p.position++
+
+	switch current.kind {
+	case tokenMinus:
+		if _, ok := p.peek(); !ok {
+			return nil, nil
+		}
+		node, err := p.parseUnary()
+		if err != nil || node == nil {
+			return nil, err
+		}
+		return Not{Node: node}, nil
+	case tokenOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenClose {
+			return nil, ErrUnbalancedParenthesis
+		}
+		p.position++
+		return node, nil
+	case tokenPhrase:
+		return Term{Field: current.field, Value: current.value, Phrase: true}, nil
+	case tokenWord:
+		return Term{Field: current.field, Value: current.value}, nil
+	}
+
+	return nil, fmt.Errorf("Unexpected token at position %d", p.position)
+}
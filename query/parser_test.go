@@ -0,0 +1,125 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  Node
+	}{
+		{
+			name:  "single term",
+			query: "falcon",
+			want:  Term{Value: "falcon"},
+		},
+		{
+			name:  "implicit AND",
+			query: "falcon  dragon",
+			want:  And{Nodes: []Node{Term{Value: "falcon"}, Term{Value: "dragon"}}},
+		},
+		{
+			name:  "explicit AND",
+			query: "falcon AND dragon",
+			want:  And{Nodes: []Node{Term{Value: "falcon"}, Term{Value: "dragon"}}},
+		},
+		{
+			name:  "OR has lower precedence than AND",
+			query: "falcon heavy OR starship",
+			want: Or{Nodes: []Node{
+				And{Nodes: []Node{Term{Value: "falcon"}, Term{Value: "heavy"}}},
+				Term{Value: "starship"},
+			}},
+		},
+		{
+			name:  "exact phrase with exclusion",
+			query: `"launch   window" -starlink`,
+			want: And{Nodes: []Node{
+				Term{Value: "launch window", Phrase: true},
+				Not{Node: Term{Value: "starlink"}},
+			}},
+		},
+		{
+			name:  "parentheses",
+			query: `(falcon OR "dragon capsule") -(starlink OR careers)`,
+			want: And{Nodes: []Node{
+				Or{Nodes: []Node{Term{Value: "falcon"}, Term{Value: "dragon capsule", Phrase: true}}},
+				Not{Node: Or{Nodes: []Node{Term{Value: "starlink"}, Term{Value: "careers"}}}},
+			}},
+		},
+		{
+			name:  "dash inside of a word",
+			query: "falcon-9 - heavy",
+			want: And{Nodes: []Node{
+				Term{Value: "falcon-9"},
+				Term{Value: "-"},
+				Term{Value: "heavy"},
+			}},
+		},
+		{
+			name:  "lowercase or is a term",
+			query: "falcon or dragon",
+			want: And{Nodes: []Node{
+				Term{Value: "falcon"},
+				Term{Value: "or"},
+				Term{Value: "dragon"},
+			}},
+		},
+		{
+			name:  "field operators",
+			query: `title:"falcon  heavy" -site:www.spacex.com path:/vehicles/* inurl:launch`,
+			want: And{Nodes: []Node{
+				Term{Field: FieldTitle, Value: "falcon heavy", Phrase: true},
+				Not{Node: Term{Field: FieldSite, Value: "www.spacex.com"}},
+				Term{Field: FieldPath, Value: "/vehicles/*"},
+				Term{Field: FieldURL, Value: "launch"},
+			}},
+		},
+		{
+			name:  "unknown field is a term",
+			query: "https://www.spacex.com author:musk",
+			want: And{Nodes: []Node{
+				Term{Value: "https://www.spacex.com"},
+				Term{Value: "author:musk"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.query)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  error
+	}{
+		{query: "   ", want: ErrEmptyQuery},
+		{query: `""`, want: ErrEmptyQuery},
+		{query: `"launch window`, want: ErrUnterminatedPhrase},
+		{query: `title:"launch window`, want: ErrUnterminatedPhrase},
+		{query: "(falcon OR dragon", want: ErrUnbalancedParenthesis},
+		{query: "falcon)", want: ErrUnbalancedParenthesis},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			_, err := Parse(test.query)
+			if err != test.want {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
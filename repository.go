@@ -1,24 +1,254 @@
 package main
 
 import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/Moranilt/search-engine/analyzer"
+	"github.com/Moranilt/search-engine/autocomplete"
+	"github.com/Moranilt/search-engine/credentials"
+	"github.com/Moranilt/search-engine/pagerank"
+	"github.com/Moranilt/search-engine/parser"
+	"github.com/Moranilt/search-engine/query"
+	"github.com/Moranilt/search-engine/spelling"
 	"github.com/jmoiron/sqlx"
 )
 
+const (
+	// Weight of the endpoint's authority in the score of search hit
+	DefaultAuthorityWeight = 1
+	// Maximum number of different bits of fingerprints of similar pages
+	DefaultSimilarityDistance = 3
+	// Number of endpoints of every host which are crawled at once by the crawl queue
+	DefaultCrawlBatch = 50
+)
+
 type Repository struct {
-	DB *sqlx.DB
+	DB                 *sqlx.DB
+	Analyzer           analyzer.Analyzer
+	Vocabulary         *Vocabulary
+	AuthorityWeight    float64
+	SimilarityDistance int
+	Fetcher            *Fetcher
+	// Encrypts credentials of hosts, nil if the key isn't configured
+	Cipher *credentials.Cipher
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
-	return &Repository{DB: db}
+	return &Repository{
+		DB:                 db,
+		Analyzer:           analyzer.New(),
+		Vocabulary:         NewVocabulary(),
+		AuthorityWeight:    DefaultAuthorityWeight,
+		SimilarityDistance: DefaultSimilarityDistance,
+		Fetcher:            NewFetcher(),
+	}
+}
+
+// LoadCredentials decrypts stored credentials of hosts and passes them to the fetcher. Hosts whose
+// credential can't be used are logged and crawled without it
+func (repository Repository) LoadCredentials() error {
+	var stored []struct {
+		Host   string `db:"host"`
+		Secret string `db:"secret"`
+	}
+	if err := repository.DB.Select(&stored, SelectHostCredentials); err != nil {
+		return err
+	}
+
+	for _, hostCredential := range stored {
+		host := Host{Name: hostCredential.Host}
+		credential, err := repository.Cipher.Decrypt(hostCredential.Secret)
+		if err == nil {
+			err = repository.Fetcher.SetCredential(host.Name, credential)
+		}
+		if err != nil {
+			log.Printf("credential of %s isn't used: %v", host.Name, err)
+		}
+	}
+	return nil
+}
+
+// Vocabulary keeps in-memory structures built from indexed terms. They are rebuilt
+// from the database periodically and replaced at once, so readers never wait for a rebuild.
+type Vocabulary struct {
+	dictionary atomic.Value
+	suggester  atomic.Value
+}
+
+func NewVocabulary() *Vocabulary {
+	vocabulary := &Vocabulary{}
+	vocabulary.dictionary.Store(spelling.NewDictionary(nil))
+	vocabulary.suggester.Store(autocomplete.NewSuggester(nil, nil))
+	return vocabulary
+}
+
+func (v *Vocabulary) Dictionary() *spelling.Dictionary {
+	return v.dictionary.Load().(*spelling.Dictionary)
+}
+
+func (v *Vocabulary) Suggester() *autocomplete.Suggester {
+	return v.suggester.Load().(*autocomplete.Suggester)
+}
+
+func (repository Repository) RefreshVocabulary() error {
+	var terms []TermFrequency
+	err := repository.DB.Select(&terms, SelectTermsFrequency)
+	if err != nil {
+		return err
+	}
+
+	var phrases []TermFrequency
+	err = repository.DB.Select(&phrases, SelectSearchedPhrases)
+	if err != nil {
+		return err
+	}
+
+	termFrequencies := make(map[string]int, len(terms))
+	for _, term := range terms {
+		termFrequencies[term.Name] = term.Frequency
+	}
+	phraseFrequencies := make(map[string]int, len(phrases))
+	for _, phrase := range phrases {
+		phraseFrequencies[phrase.Name] = phrase.Frequency
+	}
+
+	repository.Vocabulary.dictionary.Store(spelling.NewDictionary(termFrequencies))
+	repository.Vocabulary.suggester.Store(autocomplete.NewSuggester(phraseFrequencies, termFrequencies))
+
+	return nil
+}
+
+// Rebuilds vocabulary every interval until the process exits
+func (repository Repository) WatchVocabulary(interval time.Duration) {
+	for {
+		if err := repository.RefreshVocabulary(); err != nil {
+			log.Printf("vocabulary refresh failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
 }
 
-type ResultSearch struct {
-	Host  string           `json:"host"`
-	Links []LinksWithTitle `json:"links"`
+// Computes PageRank of the host's endpoints by links between them
+func (repository Repository) UpdateHostAuthority(host Host) error {
+	graph, err := host.GetLinkGraph(repository.DB)
+	if err != nil {
+		return err
+	}
+	ranks := graph.Rank(pagerank.DefaultDamping, pagerank.DefaultIterations, pagerank.DefaultTolerance)
+	return host.StoreAuthority(repository.DB, pagerank.Normalize(ranks))
+}
+
+func (repository Repository) UpdateAuthority() error {
+	var hosts []Host
+	err := repository.DB.Select(&hosts, SelectAllFromHosts)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		if err := repository.UpdateHostAuthority(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recomputes authority of all endpoints every interval until the process exits
+func (repository Repository) WatchAuthority(interval time.Duration) {
+	for {
+		if err := repository.UpdateAuthority(); err != nil {
+			log.Printf("authority update failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Crawls endpoints of searchable hosts which are known only by links, at most limit of them of
+// every host. Endpoints which were attempted the longest time ago are crawled first, so endpoints
+// which can't be fetched don't block the queue
+func (repository Repository) CrawlLinkedEndpoints(limit int) error {
+	var hosts []Host
+	err := repository.DB.Select(&hosts, SelectSearchableHosts)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		var links []string
+		if err := repository.DB.Select(&links, QueueLinkedEndpoints, host.Id, limit); err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			continue
+		}
+		if err := repository.indexLinks(host, links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Crawls endpoints which are known only by links every interval until the process exits
+func (repository Repository) WatchLinkedEndpoints(interval time.Duration, limit int) {
+	for {
+		if err := repository.CrawlLinkedEndpoints(limit); err != nil {
+			log.Printf("crawl of linked endpoints failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+type SearchResponse struct {
+	// Number of all matched pages
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Hits   []SearchHit `json:"hits"`
+	// Query with misspelled words replaced by the closest indexed terms
+	Suggestion string `json:"suggestion,omitempty"`
+	// Hit counts by values of requested facets
+	Facets map[string][]FacetCount `json:"facets,omitempty"`
+}
+
+type SearchHit struct {
+	Host string `json:"host"`
+	LinksWithTitle
+	Score float64 `json:"score"`
+	// Number of pages with similar content hidden behind this one
+	Similar int `json:"similar,omitempty"`
+	// Image, description, author and date from structured data of the page
+	Structured *parser.StructuredSummary `json:"structured,omitempty"`
+
+	host           Host
+	page           query.Page
+	simhash        uint64
+	structuredData JSONData
 }
 
 type HostWithEndpoints struct {
-	Host         string                   `json:"host"`
-	IsSearchable bool                     `json:"is_searchable"`
-	Endpoints    []EndpointBySearchPhrase `json:"endpoints"`
+	Host         string `json:"host"`
+	IsSearchable bool   `json:"is_searchable"`
+	// Host has a stored credential, the credential itself is never returned
+	Authenticated bool                     `json:"authenticated"`
+	Scope         HostScope                `json:"scope"`
+	Feeds         []HostFeed               `json:"feeds"`
+	Endpoints     []EndpointBySearchPhrase `json:"endpoints"`
+}
+
+type HostScopeRequest struct {
+	Host  string    `json:"host"`
+	Scope HostScope `json:"scope"`
+}
+
+type HostFeedRequest struct {
+	Host string `json:"host"`
+	// Absolute URL or path of the feed on the host
+	URL string `json:"url"`
+}
+
+type HostCredentialRequest struct {
+	Host       string                 `json:"host"`
+	Credential credentials.Credential `json:"credential"`
 }
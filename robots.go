@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robots.txt is requested again after a day, as RFC 9309 recommends
+	DefaultRobotsTTL = 24 * time.Hour
+	// Rules after the limit are ignored
+	maxRobotsSize = 512 << 10
+)
+
+var (
+	ErrDisallowedByRobots = errors.New("Disallowed by robots.txt")
+	// robots.txt responded with 5xx status, the whole host is disallowed until it is available
+	ErrRobotsUnavailable = errors.New("robots.txt is unavailable")
+)
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// RobotsRules are rules of robots.txt for the crawler: of groups with its product token or of "*" groups
+type RobotsRules struct {
+	rules []robotsRule
+}
+
+// ParseRobots returns rules of robots.txt for the product token, e.g. "SearchEngineBot"
+func ParseRobots(reader io.Reader, token string) RobotsRules {
+	var matching, common []robotsRule
+	var agents []string
+	inRules, hasGroup := false, false
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.IndexByte(line, '#'); index != -1 {
+			line = line[:index]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// User-agent after rules starts a new group
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, value)
+			hasGroup = hasGroup || strings.EqualFold(value, token)
+		case "allow", "disallow":
+			inRules = true
+			// Empty disallow allows everything, which is the default
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{pattern: value, allow: key == "allow"}
+			for _, agent := range agents {
+				if strings.EqualFold(agent, token) {
+					matching = append(matching, rule)
+				} else if agent == "*" {
+					common = append(common, rule)
+				}
+			}
+		}
+	}
+
+	// The group of the crawler replaces "*" groups even when it has no rules
+	if hasGroup {
+		return RobotsRules{rules: matching}
+	}
+	return RobotsRules{rules: common}
+}
+
+// Allows reports whether the page may be crawled. The longest matching rule wins, allow wins
+// over disallow of the same length
+func (r RobotsRules) Allows(page *url.URL) bool {
+	path := page.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if page.RawQuery != "" {
+		path += "?" + page.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatches(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > length || len(rule.pattern) == length && rule.allow {
+			allow, length = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// Matches the path by the pattern of the rule, "*" matches any characters and "$" is the end of the path
+func robotsPatternMatches(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		if anchored {
+			return path == pattern
+		}
+		return strings.HasPrefix(path, pattern)
+	}
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(rest, part)
+		if index == -1 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	if anchored {
+		return strings.HasSuffix(rest, parts[len(parts)-1])
+	}
+	return strings.Contains(rest, parts[len(parts)-1])
+}
+
+type robotsEntry struct {
+	// Closed when rules are loaded
+	ready   chan struct{}
+	rules   RobotsRules
+	err     error
+	expires time.Time
+}
+
+// RobotsCache keeps rules of robots.txt by scheme and host for TTL. Concurrent fetches of the host
+// wait for one request of robots.txt. Errors aren't cached
+type RobotsCache struct {
+	TTL time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func (c *RobotsCache) get(key string, load func() (RobotsRules, error)) (RobotsRules, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		select {
+		case <-entry.ready:
+			ok = entry.err == nil && time.Now().Before(entry.expires)
+		default:
+		}
+	}
+	if ok {
+		c.mutex.Unlock()
+		<-entry.ready
+		return entry.rules, entry.err
+	}
+
+	entry = &robotsEntry{ready: make(chan struct{})}
+	if c.entries == nil {
+		c.entries = make(map[string]*robotsEntry)
+	}
+	c.entries[key] = entry
+	c.mutex.Unlock()
+
+	entry.rules, entry.err = load()
+	entry.expires = time.Now().Add(c.TTL)
+	close(entry.ready)
+	return entry.rules, entry.err
+}
+
+// checkRobots returns *FetchError when robots.txt of the host disallows the page for the crawler
+func (f *Fetcher) checkRobots(ctx context.Context, pageURL string, requestURL *url.URL) error {
+	if f.IgnoreRobots {
+		return nil
+	}
+	key := strings.ToLower(requestURL.Scheme + "://" + requestURL.Host)
+	rules, err := f.Robots.get(key, func() (RobotsRules, error) {
+		return f.fetchRobots(ctx, requestURL)
+	})
+	if err == nil && !rules.Allows(requestURL) {
+		err = ErrDisallowedByRobots
+	}
+	if err != nil {
+		return f.fail(pageURL, classifyError(err), 0, err)
+	}
+	return nil
+}
+
+// fetchRobots requests robots.txt of the host of the page with the identity of the crawler.
+// Missing robots.txt allows everything
+func (f *Fetcher) fetchRobots(ctx context.Context, page *url.URL) (RobotsRules, error) {
+	robotsURL := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: "/robots.txt"}
+	response, err := f.get(ctx, robotsURL, nil)
+	if errors.Is(err, ErrTooManyRedirects) || errors.Is(err, ErrCrossHostRedirect) {
+		return RobotsRules{}, nil
+	}
+	if err != nil {
+		return RobotsRules{}, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError:
+		return RobotsRules{}, ErrRobotsUnavailable
+	case response.StatusCode >= http.StatusBadRequest:
+		return RobotsRules{}, nil
+	}
+	return ParseRobots(io.LimitReader(response.Body, maxRobotsSize), f.Identity.Token()), nil
+}
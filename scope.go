@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+type ScopeKind string
+
+const (
+	// Pages of the host only
+	ScopeHost ScopeKind = "host"
+	// Pages of the host and its subdomains, e.g. "blog.example.com" for "www.example.com"
+	ScopeSubdomains ScopeKind = "subdomains"
+	// Pages of the host which paths start with one of the values, e.g. "/docs/"
+	ScopePathPrefix ScopeKind = "path_prefix"
+	// Pages of the host and of hosts from the values, "*.example.com" matches subdomains
+	ScopeAllowlist ScopeKind = "allowlist"
+)
+
+// HostScope is the set of pages which are followed by links from pages of the host
+type HostScope struct {
+	Kind   ScopeKind `json:"kind"`
+	Values []string  `json:"values,omitempty"`
+}
+
+func (s HostScope) Validate() error {
+	switch s.Kind {
+	case ScopeHost, ScopeSubdomains:
+		if len(s.Values) > 0 {
+			return errors.New("Scope " + string(s.Kind) + " has no values")
+		}
+	case ScopePathPrefix:
+		if len(s.Values) == 0 {
+			return errors.New("Scope path_prefix needs path prefixes")
+		}
+		for _, prefix := range s.Values {
+			if !strings.HasPrefix(prefix, "/") {
+				return errors.New("Path prefix " + prefix + " must start with /")
+			}
+		}
+	case ScopeAllowlist:
+		if len(s.Values) == 0 {
+			return errors.New("Scope allowlist needs host names")
+		}
+		for _, hostname := range s.Values {
+			if strings.TrimPrefix(hostname, "*.") == "" || strings.ContainsAny(hostname, "/: ") {
+				return errors.New("Allowed host " + hostname + " must be a host name, e.g. blog.example.com or *.example.com")
+			}
+		}
+	default:
+		return errors.New("Unknown scope kind " + string(s.Kind) + ", expected one of host, subdomains, path_prefix, allowlist")
+	}
+	return nil
+}
+
+// Contains reports whether the page is in scope of the host with the hostname
+func (s HostScope) Contains(hostname string, page *url.URL) bool {
+	hostname = strings.ToLower(hostname)
+	target := strings.ToLower(page.Hostname())
+	switch s.Kind {
+	case ScopeSubdomains:
+		domain := strings.TrimPrefix(hostname, "www.")
+		return target == hostname || target == domain || strings.HasSuffix(target, "."+domain)
+	case ScopePathPrefix:
+		if target != hostname {
+			return false
+		}
+		path := page.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		for _, prefix := range s.Values {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	case ScopeAllowlist:
+		if target == hostname {
+			return true
+		}
+		for _, allowed := range s.Values {
+			allowed = strings.ToLower(allowed)
+			if domain := strings.TrimPrefix(allowed, "*."); domain != allowed {
+				if strings.HasSuffix(target, "."+domain) {
+					return true
+				}
+			} else if target == allowed {
+				return true
+			}
+		}
+		return false
+	}
+	return target == hostname
+}
+
+// LinkScope is where the link from a page of the host leads
+type LinkScope int
+
+const (
+	// Not a link to a web page, e.g. "ftp:"
+	LinkInvalid LinkScope = iota
+	// Page of the host in its scope
+	LinkInternal
+	// Page of another host in the scope of the host, it is followed and stored as endpoint of its host
+	LinkFollowed
+	// Page of the host out of its scope, it isn't followed
+	LinkExcluded
+	// Page of another host out of the scope, it is stored as external link for host suggestions
+	LinkExternal
+)
+
+func (h Host) Scope() HostScope {
+	if h.ScopeKind == "" {
+		return HostScope{Kind: ScopeHost}
+	}
+	return HostScope{Kind: ScopeKind(h.ScopeKind), Values: h.ScopeValues}
+}
+
+// ClassifyLink resolves href found on the source endpoint to absolute URL and tells where it leads
+func (h Host) ClassifyLink(source string, href string) (*url.URL, LinkScope) {
+	target, ok := h.resolveURL(source, href)
+	if !ok {
+		return nil, LinkInvalid
+	}
+	sameHost := strings.EqualFold(target.Hostname(), h.Hostname())
+	switch inScope := h.Scope().Contains(h.Hostname(), target); {
+	case sameHost && inScope:
+		return target, LinkInternal
+	case sameHost:
+		return target, LinkExcluded
+	case inScope:
+		return target, LinkFollowed
+	}
+	return target, LinkExternal
+}
+
+// Returns name of the host of the URL as it is stored, e.g. "https://blog.example.com/". Default
+// port of the scheme is dropped
+func hostNameOf(page *url.URL) string {
+	scheme := strings.ToLower(page.Scheme)
+	host := strings.ToLower(page.Hostname())
+	if port := page.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	}
+	return scheme + "://" + host + "/"
+}
+
+// Indexes pages of other hosts by their host names. Hosts are compared by host name as links are,
+// so the page of "http://www.nasa.gov/" is stored for the host "https://www.nasa.gov/". Hosts which
+// don't exist yet are created, they are searched as other hosts and can be activated to be crawled entirely
+func (repository Repository) indexFollowedLinks(linksByHost map[string][]string) error {
+	for hostName, links := range linksByHost {
+		var host Host
+		if err := repository.DB.Get(&host, SelectLinkedHost, hostName); err != nil {
+			return err
+		}
+		if err := repository.indexLinks(host, links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Package simhash computes fingerprints of texts which differ in a few bits for similar texts
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+// Number of consecutive tokens hashed together
+const ShingleSize = 3
+
+// Fingerprint returns SimHash of the tokens, 0 for no tokens
+func Fingerprint(tokens []string) uint64 {
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	size := ShingleSize
+	if len(tokens) < size {
+		size = len(tokens)
+	}
+	for i := 0; i+size <= len(tokens); i++ {
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(tokens[i:i+size], " ")))
+		sum := hash.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// Distance returns number of different bits of the fingerprints
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,60 @@
+package simhash
+
+import (
+	"strings"
+	"testing"
+)
+
+const launchText = `SpaceX designs manufactures and launches advanced rockets and spacecraft.
+The company was founded in 2002 to revolutionize space technology with the ultimate goal
+of enabling people to live on other planets. Falcon 9 is a reusable two stage rocket
+designed and manufactured by SpaceX for the reliable and safe transport of people and
+payloads into Earth orbit and beyond. Falcon 9 is the world's first orbital class
+reusable rocket. Reusability allows SpaceX to refly the most expensive parts of the
+rocket which in turn drives down the cost of space access. Dragon is a free flying
+spacecraft designed to deliver both cargo and people to orbiting destinations.`
+
+func TestFingerprint(t *testing.T) {
+	tokens := strings.Fields(strings.ToLower(launchText))
+
+	if got := Fingerprint(nil); got != 0 {
+		t.Errorf("got %x for no tokens, want 0", got)
+	}
+	if Fingerprint(tokens) != Fingerprint(append([]string{}, tokens...)) {
+		t.Error("fingerprint must be deterministic")
+	}
+	if Fingerprint([]string{"falcon"}) == 0 {
+		t.Error("fingerprint of a short text must not be empty")
+	}
+
+	// Same page with a different footer
+	similar := append(append([]string{}, tokens...), "copyright", "2023", "spacex")
+	if distance := Distance(Fingerprint(tokens), Fingerprint(similar)); distance > 3 {
+		t.Errorf("distance between similar texts is %d, want at most 3", distance)
+	}
+
+	different := strings.Fields(`NASA is an independent agency of the US federal government responsible
+for the civil space program aeronautics research and space research. Artemis missions will land
+the first woman and first person of color on the Moon using innovative technologies to explore
+more of the lunar surface than ever before.`)
+	if distance := Distance(Fingerprint(tokens), Fingerprint(different)); distance < 10 {
+		t.Errorf("distance between different texts is %d, want at least 10", distance)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{a: 0, b: 0, want: 0},
+		{a: 0b1011, b: 0b0010, want: 2},
+		{a: 0, b: ^uint64(0), want: 64},
+	}
+
+	for _, test := range tests {
+		if got := Distance(test.a, test.b); got != test.want {
+			t.Errorf("Distance(%b, %b) got %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
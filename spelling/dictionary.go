@@ -0,0 +1,128 @@
+package spelling
+
+import "sort"
+
+// Dictionary is an immutable set of indexed terms with their frequencies. Terms are
+// looked up by padded bigrams, so candidates for correction are found without comparing
+// the word to every term.
+type Dictionary struct {
+	terms   []string
+	counts  map[string]int
+	bigrams map[string][]int
+}
+
+type Candidate struct {
+	Term      string
+	Distance  int
+	Frequency int
+}
+
+func NewDictionary(frequencies map[string]int) *Dictionary {
+	dictionary := &Dictionary{
+		terms:   make([]string, 0, len(frequencies)),
+		counts:  make(map[string]int, len(frequencies)),
+		bigrams: make(map[string][]int),
+	}
+
+	for term, frequency := range frequencies {
+		dictionary.counts[term] = frequency
+		dictionary.terms = append(dictionary.terms, term)
+	}
+	sort.Strings(dictionary.terms)
+
+	for index, term := range dictionary.terms {
+		for _, bigram := range bigrams(term) {
+			dictionary.bigrams[bigram] = append(dictionary.bigrams[bigram], index)
+		}
+	}
+
+	return dictionary
+}
+
+func (d *Dictionary) Len() int {
+	return len(d.terms)
+}
+
+func (d *Dictionary) Contains(term string) bool {
+	_, ok := d.counts[term]
+	return ok
+}
+
+func (d *Dictionary) Frequency(term string) int {
+	return d.counts[term]
+}
+
+// MaxDistance returns how many typos are tolerated in a word: none for words shorter than
+// 3 characters, one for words up to 5 characters and two for longer words
+func MaxDistance(word string) int {
+	switch length := len([]rune(word)); {
+	case length < 3:
+		return 0
+	case length <= 5:
+		return 1
+	}
+	return 2
+}
+
+// Candidates returns terms within MaxDistance of the word ordered by distance
+// and then by frequency
+func (d *Dictionary) Candidates(word string) []Candidate {
+	maxDistance := MaxDistance(word)
+	if maxDistance == 0 {
+		return nil
+	}
+
+	checked := make(map[int]bool)
+	var candidates []Candidate
+	length := len([]rune(word))
+
+	for _, bigram := range bigrams(word) {
+		for _, index := range d.bigrams[bigram] {
+			if checked[index] {
+				continue
+			}
+			checked[index] = true
+
+			term := d.terms[index]
+			if difference := len([]rune(term)) - length; difference > maxDistance || -difference > maxDistance {
+				continue
+			}
+			if distance := Distance(word, term); distance <= maxDistance {
+				candidates = append(candidates, Candidate{Term: term, Distance: distance, Frequency: d.counts[term]})
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Distance != candidates[j].Distance {
+			return candidates[i].Distance < candidates[j].Distance
+		}
+		if candidates[i].Frequency != candidates[j].Frequency {
+			return candidates[i].Frequency > candidates[j].Frequency
+		}
+		return candidates[i].Term < candidates[j].Term
+	})
+
+	return candidates
+}
+
+// Correct returns the closest term for a word which is not in the dictionary.
+// Known words and words without close terms are returned as is.
+func (d *Dictionary) Correct(word string) string {
+	if d.Contains(word) {
+		return word
+	}
+	if candidates := d.Candidates(word); len(candidates) > 0 {
+		return candidates[0].Term
+	}
+	return word
+}
+
+func bigrams(word string) []string {
+	padded := []rune("^" + word + "$")
+	result := make([]string, 0, len(padded)-1)
+	for i := 0; i+1 < len(padded); i++ {
+		result = append(result, string(padded[i:i+2]))
+	}
+	return result
+}
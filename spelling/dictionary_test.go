@@ -0,0 +1,54 @@
+package spelling
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDictionaryCorrect(t *testing.T) {
+	dictionary := NewDictionary(map[string]int{
+		"falcon":   10,
+		"falken":   1,
+		"dragon":   7,
+		"launch":   12,
+		"lunch":    2,
+		"starship": 3,
+		"ракета":   4,
+		"cat":      5,
+	})
+
+	tests := map[string]string{
+		"falcon":   "falcon",
+		"falcn":    "falcon",
+		"flacon":   "falcon",
+		"lanch":    "launch",
+		"dargon":   "dragon",
+		"strship":  "starship",
+		"рокета":   "ракета",
+		"cut":      "cat",
+		"xy":       "xy",
+		"mars":     "mars",
+		"starlink": "starlink",
+	}
+
+	for word, want := range tests {
+		if got := dictionary.Correct(word); got != want {
+			t.Errorf("Correct(%q) got %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestDictionaryCandidates(t *testing.T) {
+	dictionary := NewDictionary(map[string]int{"falcon": 10, "falken": 1, "balcon": 3, "falcons": 2})
+
+	got := dictionary.Candidates("falcen")
+	want := []Candidate{
+		{Term: "falcon", Distance: 1, Frequency: 10},
+		{Term: "falken", Distance: 1, Frequency: 1},
+		{Term: "balcon", Distance: 2, Frequency: 3},
+		{Term: "falcons", Distance: 2, Frequency: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
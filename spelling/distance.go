@@ -0,0 +1,41 @@
+package spelling
+
+// Distance returns the number of insertions, deletions, substitutions and transpositions
+// of adjacent characters needed to turn a into b (optimal string alignment distance)
+func Distance(a string, b string) int {
+	first, second := []rune(a), []rune(b)
+
+	previousRow := make([]int, len(second)+1)
+	row := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for j := range current {
+		current[j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		previousRow, row, current = row, current, previousRow
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			current[j] = min(row[j]+1, current[j-1]+1, row[j-1]+cost)
+			if i > 1 && j > 1 && first[i-1] == second[j-2] && first[i-2] == second[j-1] {
+				current[j] = min(current[j], previousRow[j-2]+1)
+			}
+		}
+	}
+
+	return current[len(second)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,24 @@
+package spelling
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "falcon", b: "falcon", want: 0},
+		{a: "falcn", b: "falcon", want: 1},
+		{a: "flacon", b: "falcon", want: 1},
+		{a: "falcon", b: "falken", want: 2},
+		{a: "", b: "dragon", want: 6},
+		{a: "ракета", b: "рокета", want: 1},
+		{a: "ca", b: "abc", want: 3},
+	}
+
+	for _, test := range tests {
+		if got := Distance(test.a, test.b); got != test.want {
+			t.Errorf("Distance(%q, %q) got %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}